@@ -0,0 +1,395 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds every runtime setting. It is built once in main and handed to
+// each component, so nothing reads the environment on its own.
+type Config struct {
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Auth        AuthConfig
+	Stripe      StripeConfig
+	LogLevel    string
+	Tracing     TracingConfig
+	Inventory   InventoryConfig
+	Jobs        JobsConfig
+	Events      EventsConfig
+	Webhooks    WebhooksConfig
+	Mail        MailConfig
+	Idempotency IdempotencyConfig
+}
+
+type ServerConfig struct {
+	Port              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// DrainDelay is how long shutdown keeps serving after /readyz starts
+	// failing, so the load balancer stops routing here before the listener closes
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type DatabaseConfig struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectRetries is how many times startup retries the first ping,
+	// waiting ConnectBackoff and doubling it (up to ConnectMaxBackoff) each time
+	ConnectRetries    int
+	ConnectBackoff    time.Duration
+	ConnectMaxBackoff time.Duration
+	QueryTimeout      time.Duration
+	// ReplicaURL is optional; when set, catalog and order-history reads go there
+	ReplicaURL           string
+	ReplicaCheckInterval time.Duration
+}
+
+type AuthConfig struct {
+	JWTSecret string
+	TokenTTL  time.Duration
+}
+
+type StripeConfig struct {
+	SecretKey string
+	// WebhookSecret is the signing secret of the webhook endpoint, used to
+	// verify that events come from Stripe
+	WebhookSecret string
+}
+
+type TracingConfig struct {
+	// Exporter is one of "otlp", "stdout" or "none"
+	Exporter    string
+	ServiceName string
+}
+
+type InventoryConfig struct {
+	// LowStockThreshold applies to products without their own threshold
+	LowStockThreshold int
+	// ReservationTTL is how long an unpaid order holds its stock before the
+	// expiry worker, running every ExpiryInterval, cancels it
+	ReservationTTL time.Duration
+	ExpiryInterval time.Duration
+}
+
+type JobsConfig struct {
+	// Workers is how many jobs run concurrently in this process; 0 leaves the
+	// queue to a separate `worker` process
+	Workers      int
+	PollInterval time.Duration
+	// MaxAttempts is the default number of tries before a job is dead-lettered;
+	// retry n waits Backoff*2^(n-1), capped at MaxBackoff
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds one attempt; a job locked for twice as long is requeued
+	Timeout   time.Duration
+	Retention time.Duration
+}
+
+type EventsConfig struct {
+	// Sinks lists where the outbox relay publishes: any of "log", "http", "nats"
+	Sinks         []string
+	HTTPURL       string
+	NATSURL       string
+	SubjectPrefix string
+	RelayInterval time.Duration
+	BatchSize     int
+	// PublishTimeout bounds the delivery of one event to all sinks
+	PublishTimeout time.Duration
+	// A failing event is retried with backoff from RelayBackoff up to
+	// RelayMaxBackoff and dead-lettered after RelayMaxAttempts
+	RelayMaxAttempts int
+	RelayBackoff     time.Duration
+	RelayMaxBackoff  time.Duration
+}
+
+type WebhooksConfig struct {
+	// MaxAttempts is how many times a delivery is tried before it is marked failed
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+type IdempotencyConfig struct {
+	// LockTTL is how long a request holds its Idempotency-Key before a retry
+	// may take it over; it should outlast the slowest request
+	LockTTL time.Duration
+	// Retention is how long a finished response is replayed
+	Retention time.Duration
+}
+
+type MailConfig struct {
+	// Mailer is "smtp", or "file" to write each message to CaptureDir instead
+	Mailer       string
+	From         string
+	StoreName    string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	CaptureDir   string
+}
+
+const defaultEnvFile = ".env"
+
+// Load builds the configuration from, in increasing order of precedence:
+// defaults, the optional env file, the process environment and command-line flags.
+// A missing default .env file is not an error; a missing file passed with -config is.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("e-commerce", flag.ContinueOnError)
+	envFile := fs.String("config", defaultEnvFile, "path to an optional env file")
+	port := fs.String("port", "", "HTTP port to listen on")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn, error")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// godotenv never overrides variables already set, so the real environment wins
+	if err := godotenv.Load(*envFile); err != nil {
+		if *envFile != defaultEnvFile || !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("loading env file %s: %w", *envFile, err)
+		}
+	}
+
+	l := &loader{}
+	cfg := &Config{
+		Server: ServerConfig{
+			Port:              l.string("PORT", "8080"),
+			ReadHeaderTimeout: l.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       l.duration("SERVER_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:      l.duration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:       l.duration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			DrainDelay:        l.duration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+			ShutdownTimeout:   l.duration("SERVER_SHUTDOWN_TIMEOUT", 20*time.Second),
+		},
+		Database: DatabaseConfig{
+			URL:                  l.required("DATABASE_URL"),
+			MaxOpenConns:         l.int("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:         l.int("DB_MAX_IDLE_CONNS", 25),
+			ConnMaxLifetime:      l.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime:      l.duration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			ConnectRetries:       l.int("DB_CONNECT_RETRIES", 5),
+			ConnectBackoff:       l.duration("DB_CONNECT_BACKOFF", 500*time.Millisecond),
+			ConnectMaxBackoff:    l.duration("DB_CONNECT_MAX_BACKOFF", 10*time.Second),
+			QueryTimeout:         l.duration("DB_QUERY_TIMEOUT", 5*time.Second),
+			ReplicaURL:           l.string("DATABASE_REPLICA_URL", ""),
+			ReplicaCheckInterval: l.duration("DB_REPLICA_CHECK_INTERVAL", 10*time.Second),
+		},
+		Auth: AuthConfig{
+			JWTSecret: l.required("JWT_SECRET"),
+			TokenTTL:  l.duration("JWT_TTL", 24*time.Hour),
+		},
+		Stripe: StripeConfig{
+			SecretKey:     l.required("STRIPE_SECRET_KEY"),
+			WebhookSecret: l.required("STRIPE_WEBHOOK_SECRET"),
+		},
+		LogLevel: l.string("LOG_LEVEL", "info"),
+		Tracing: TracingConfig{
+			Exporter:    l.oneOf("OTEL_TRACES_EXPORTER", "none", "otlp", "stdout", "none"),
+			ServiceName: l.string("OTEL_SERVICE_NAME", "e-commerce"),
+		},
+		Inventory: InventoryConfig{
+			LowStockThreshold: l.int("LOW_STOCK_THRESHOLD", 5),
+			ReservationTTL:    l.duration("ORDER_RESERVATION_TTL", 30*time.Minute),
+			ExpiryInterval:    l.duration("ORDER_EXPIRY_INTERVAL", time.Minute),
+		},
+		Jobs: JobsConfig{
+			Workers:      l.int("JOBS_WORKERS", 4),
+			PollInterval: l.duration("JOBS_POLL_INTERVAL", time.Second),
+			MaxAttempts:  l.int("JOBS_MAX_ATTEMPTS", 5),
+			Backoff:      l.duration("JOBS_BACKOFF", 10*time.Second),
+			MaxBackoff:   l.duration("JOBS_MAX_BACKOFF", time.Hour),
+			Timeout:      l.duration("JOBS_TIMEOUT", time.Minute),
+			Retention:    l.duration("JOBS_RETENTION", 7*24*time.Hour),
+		},
+		Events: EventsConfig{
+			Sinks:            l.list("EVENT_SINKS", "log"),
+			HTTPURL:          l.string("EVENT_HTTP_URL", ""),
+			NATSURL:          l.string("NATS_URL", "nats://localhost:4222"),
+			SubjectPrefix:    l.string("EVENT_SUBJECT_PREFIX", "ecommerce"),
+			RelayInterval:    l.duration("EVENT_RELAY_INTERVAL", time.Second),
+			BatchSize:        l.int("EVENT_RELAY_BATCH_SIZE", 100),
+			PublishTimeout:   l.duration("EVENT_PUBLISH_TIMEOUT", 10*time.Second),
+			RelayMaxAttempts: l.int("EVENT_RELAY_MAX_ATTEMPTS", 10),
+			RelayBackoff:     l.duration("EVENT_RELAY_BACKOFF", 5*time.Second),
+			RelayMaxBackoff:  l.duration("EVENT_RELAY_MAX_BACKOFF", 10*time.Minute),
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: l.int("WEBHOOK_MAX_ATTEMPTS", 8),
+			Timeout:     l.duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		},
+		Mail: MailConfig{
+			Mailer:       l.oneOf("MAILER", "file", "smtp", "file"),
+			From:         l.string("MAIL_FROM", "E-Commerce <no-reply@localhost>"),
+			StoreName:    l.string("STORE_NAME", "E-Commerce"),
+			SMTPAddr:     l.string("SMTP_ADDR", ""),
+			SMTPUsername: l.string("SMTP_USERNAME", ""),
+			SMTPPassword: l.string("SMTP_PASSWORD", ""),
+			CaptureDir:   l.string("MAIL_CAPTURE_DIR", "mail"),
+		},
+		Idempotency: IdempotencyConfig{
+			LockTTL:   l.duration("IDEMPOTENCY_LOCK_TTL", time.Minute),
+			Retention: l.duration("IDEMPOTENCY_RETENTION", 24*time.Hour),
+		},
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = *port
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		}
+	})
+
+	server := cfg.Server
+	if server.ReadHeaderTimeout <= 0 || server.ReadTimeout <= 0 || server.WriteTimeout <= 0 || server.IdleTimeout <= 0 || server.ShutdownTimeout <= 0 {
+		l.errs = append(l.errs, errors.New("SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT, SERVER_IDLE_TIMEOUT and SERVER_SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if cfg.Server.DrainDelay < 0 {
+		l.errs = append(l.errs, errors.New("SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+	db := cfg.Database
+	if db.QueryTimeout <= 0 {
+		l.errs = append(l.errs, errors.New("DB_QUERY_TIMEOUT must be positive"))
+	}
+	if db.MaxOpenConns <= 0 || db.MaxIdleConns <= 0 {
+		l.errs = append(l.errs, errors.New("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must be positive"))
+	}
+	if db.ConnectRetries < 0 {
+		l.errs = append(l.errs, errors.New("DB_CONNECT_RETRIES must not be negative"))
+	}
+	if db.ConnectBackoff <= 0 || db.ConnectMaxBackoff <= 0 || db.ReplicaCheckInterval <= 0 {
+		l.errs = append(l.errs, errors.New("DB_CONNECT_BACKOFF, DB_CONNECT_MAX_BACKOFF and DB_REPLICA_CHECK_INTERVAL must be positive"))
+	}
+
+	if cfg.Inventory.ReservationTTL <= 0 || cfg.Inventory.ExpiryInterval <= 0 {
+		l.errs = append(l.errs, errors.New("ORDER_RESERVATION_TTL and ORDER_EXPIRY_INTERVAL must be positive"))
+	}
+	if cfg.Jobs.PollInterval <= 0 || cfg.Jobs.Backoff <= 0 || cfg.Jobs.MaxBackoff <= 0 || cfg.Jobs.Timeout <= 0 {
+		l.errs = append(l.errs, errors.New("JOBS_POLL_INTERVAL, JOBS_BACKOFF, JOBS_MAX_BACKOFF and JOBS_TIMEOUT must be positive"))
+	}
+	if cfg.Jobs.MaxAttempts <= 0 {
+		l.errs = append(l.errs, errors.New("JOBS_MAX_ATTEMPTS must be positive"))
+	}
+
+	for _, sink := range cfg.Events.Sinks {
+		switch sink {
+		case "log", "nats":
+		case "http":
+			if cfg.Events.HTTPURL == "" {
+				l.errs = append(l.errs, errors.New("EVENT_HTTP_URL is required when EVENT_SINKS includes http"))
+			}
+		default:
+			l.errs = append(l.errs, fmt.Errorf("EVENT_SINKS: unknown sink %q, expected log, http or nats", sink))
+		}
+	}
+	if cfg.Events.RelayInterval <= 0 || cfg.Events.BatchSize <= 0 || cfg.Events.PublishTimeout <= 0 {
+		l.errs = append(l.errs, errors.New("EVENT_RELAY_INTERVAL, EVENT_RELAY_BATCH_SIZE and EVENT_PUBLISH_TIMEOUT must be positive"))
+	}
+	if cfg.Events.RelayMaxAttempts <= 0 || cfg.Events.RelayBackoff <= 0 || cfg.Events.RelayMaxBackoff <= 0 {
+		l.errs = append(l.errs, errors.New("EVENT_RELAY_MAX_ATTEMPTS, EVENT_RELAY_BACKOFF and EVENT_RELAY_MAX_BACKOFF must be positive"))
+	}
+
+	if cfg.Idempotency.LockTTL <= 0 || cfg.Idempotency.Retention <= 0 {
+		l.errs = append(l.errs, errors.New("IDEMPOTENCY_LOCK_TTL and IDEMPOTENCY_RETENTION must be positive"))
+	}
+
+	if cfg.Webhooks.MaxAttempts <= 0 || cfg.Webhooks.Timeout <= 0 {
+		l.errs = append(l.errs, errors.New("WEBHOOK_MAX_ATTEMPTS and WEBHOOK_TIMEOUT must be positive"))
+	}
+
+	if cfg.Mail.Mailer == "smtp" && cfg.Mail.SMTPAddr == "" {
+		l.errs = append(l.errs, errors.New("SMTP_ADDR is required when MAILER is smtp"))
+	}
+
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	return cfg, nil
+}
+
+// loader reads typed values from the environment and collects every problem
+// so a bad deploy reports all missing settings at once
+type loader struct {
+	errs []error
+}
+
+func (l *loader) string(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+func (l *loader) required(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		l.errs = append(l.errs, fmt.Errorf("%s is required", key))
+	}
+	return value
+}
+
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+		return def
+	}
+	return d
+}
+
+func (l *loader) int(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return def
+	}
+	return n
+}
+
+// list reads a comma-separated value; an explicitly empty list is allowed via "none"
+func (l *loader) list(key, def string) []string {
+	value := l.string(key, def)
+	if strings.EqualFold(value, "none") {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (l *loader) oneOf(key, def string, options ...string) string {
+	value := strings.ToLower(l.string(key, def))
+	for _, option := range options {
+		if value == option {
+			return value
+		}
+	}
+	l.errs = append(l.errs, fmt.Errorf("%s must be one of %s, got %q", key, strings.Join(options, ", "), value))
+	return def
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test")
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setRequired(t)
+	if _, err := Load(nil); err != nil {
+		t.Fatalf("Load with defaults: %v", err)
+	}
+}
+
+func TestLoadRejectsNonPositiveSettings(t *testing.T) {
+	tests := []struct {
+		key, value string
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", "0s"},
+		{"SERVER_READ_TIMEOUT", "-1s"},
+		{"SERVER_WRITE_TIMEOUT", "0s"},
+		{"SERVER_IDLE_TIMEOUT", "0s"},
+		{"SERVER_SHUTDOWN_TIMEOUT", "-20s"},
+		{"SHUTDOWN_DRAIN_DELAY", "-1s"},
+		{"DB_QUERY_TIMEOUT", "0s"},
+		{"DB_QUERY_TIMEOUT", "-5s"},
+		{"DB_MAX_OPEN_CONNS", "0"},
+		{"DB_MAX_OPEN_CONNS", "-1"},
+		{"DB_MAX_IDLE_CONNS", "-3"},
+		{"DB_CONNECT_RETRIES", "-1"},
+		{"DB_CONNECT_BACKOFF", "0s"},
+		{"DB_REPLICA_CHECK_INTERVAL", "0s"},
+		{"ORDER_RESERVATION_TTL", "0s"},
+		{"ORDER_RESERVATION_TTL", "-30m"},
+		{"ORDER_EXPIRY_INTERVAL", "0s"},
+		{"JOBS_MAX_ATTEMPTS", "0"},
+		{"JOBS_MAX_BACKOFF", "-1s"},
+		{"JOBS_BACKOFF", "0s"},
+		{"EVENT_RELAY_MAX_ATTEMPTS", "0"},
+		{"EVENT_RELAY_BACKOFF", "-1s"},
+		{"WEBHOOK_MAX_ATTEMPTS", "0"},
+		{"WEBHOOK_TIMEOUT", "-5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv(tt.key, tt.value)
+			_, err := Load(nil)
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Fatalf("Load = %v, want an error naming %s", err, tt.key)
+			}
+		})
+	}
+}
@@ -1,37 +1,101 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"e-commerce/config"
+	"log/slog"
 	"os"
-	"github.com/joho/godotenv"
+	"time"
+
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
 
-func ConnectDB(){
-	if err:= godotenv.Load(); err != nil {
-		log.Fatal("Error loading environment variables")
-	}
+var queryTimeout = 5 * time.Second
 
-	dsn := os.Getenv("DATABASE_URL")
+func ConnectDB(cfg config.DatabaseConfig){
 	var err error
-	DB, err = sql.Open("pgx", dsn)
+	DB, err = open(cfg, cfg.URL, "primary")
+	if err != nil {
+		slog.Error("Error opening database", "error", err)
+		os.Exit(1)
+	}
+	queryTimeout = cfg.QueryTimeout
+
+	if err := pingWithRetry(cfg); err != nil {
+		slog.Error("Error connecting to the database", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Connected to Postgres successfully.")
+
+	if cfg.ReplicaURL != "" {
+		connectReplica(cfg)
+	}
+}
+
+// open creates a pool with the configured limits. Every query gets a span,
+// parented to the request span when a context is passed.
+func open(cfg config.DatabaseConfig, dsn, role string) (*sql.DB, error) {
+	db, err := otelsql.Open("pgx", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL, attribute.String("db.role", role)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitRows: true, OmitConnResetSession: true}),
+	)
 	if err != nil {
-		log.Fatal("Error opening database:", err)
+		return nil, err
 	}
 
-	if err := DB.Ping(); err != nil {
-		log.Fatal("Error connecting to the database:", err)
+	configurePool(db, cfg)
+	return db, nil
+}
+
+func configurePool(db *sql.DB, cfg config.DatabaseConfig) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// pingWithRetry lets the app start before Postgres is accepting connections,
+// backing off exponentially between attempts
+func pingWithRetry(cfg config.DatabaseConfig) error {
+	backoff := cfg.ConnectBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		err = DB.PingContext(ctx)
+		cancel()
+		if err == nil || attempt >= cfg.ConnectRetries {
+			return err
+		}
+
+		slog.Warn("Database not reachable, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > cfg.ConnectMaxBackoff {
+			backoff = cfg.ConnectMaxBackoff
+		}
 	}
+}
 
-	log.Println("Connected to Postgres successfully.")
+// WithTimeout bounds database work by the configured query timeout. Deriving it
+// from the request context means a client disconnect also cancels the query.
+func WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
 }
 
 func CloseDB(){
+	stopReplicaChecks()
+	if Replica != nil {
+		Replica.Close()
+	}
 	if DB != nil {
 		DB.Close()
-		log.Println("Connection closed successfully.")
+		slog.Info("Connection closed successfully.")
 	}
-}
\ No newline at end of file
+}
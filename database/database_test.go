@@ -0,0 +1,65 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/config"
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"testing"
+	"time"
+)
+
+func TestConfigurePoolAppliesLimits(t *testing.T) {
+	dbtest.New(t, nil)
+	database.ConfigurePool(database.DB, config.DatabaseConfig{
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Hour,
+		ConnMaxIdleTime: time.Hour,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		conn, err := database.DB.Conn(ctx)
+		if err != nil {
+			t.Fatalf("conn %d: %v", i, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+
+	// A fourth connection has to wait for one of the three to be released
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if conn, err := database.DB.Conn(waitCtx); err == nil {
+		conn.Close()
+		t.Fatal("got a fourth connection past DB_MAX_OPEN_CONNS=3")
+	}
+
+	stats := database.DB.Stats()
+	if stats.MaxOpenConnections != 3 || stats.InUse != 3 || stats.WaitCount != 1 {
+		t.Errorf("stats = %+v, want 3 max open, 3 in use and 1 wait", stats)
+	}
+}
+
+func TestConfigurePoolKeepsMaxIdleConns(t *testing.T) {
+	dbtest.New(t, nil)
+	database.ConfigurePool(database.DB, config.DatabaseConfig{MaxOpenConns: 5, MaxIdleConns: 2})
+
+	var conns []*sql.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := database.DB.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("conn %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	stats := database.DB.Stats()
+	if stats.Idle != 2 || stats.MaxIdleClosed != 2 {
+		t.Errorf("stats = %+v, want 2 idle and 2 closed past DB_MAX_IDLE_CONNS", stats)
+	}
+}
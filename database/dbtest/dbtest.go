@@ -0,0 +1,195 @@
+// Package dbtest replaces the database with a scripted fake, so handlers and
+// services can be tested without Postgres. A test supplies a Handler that
+// answers each statement; everything the code ran is recorded in order.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"e-commerce/database"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Result is the answer to one statement. Rows are returned for queries and
+// RowsAffected for execs; a non-nil Err fails the statement. Columns only
+// need naming when the code reads them by name.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+	Err          error
+}
+
+// Handler answers a statement. Unmatched statements should return the zero
+// Result, which is no rows and nothing affected.
+type Handler func(query string, args []driver.Value) Result
+
+// Call is one statement the code under test ran. Transactions show up as
+// BEGIN, COMMIT and ROLLBACK calls.
+type Call struct {
+	Query string
+	Args  []driver.Value
+}
+
+// DB is the fake installed as database.DB
+type DB struct {
+	mu      sync.Mutex
+	handler Handler
+	calls   []Call
+}
+
+// New installs a fake answering with h as database.DB for the rest of the test
+func New(t testing.TB, h Handler) *DB {
+	t.Helper()
+	db := &DB{handler: h}
+	previous := database.DB
+	database.DB = sql.OpenDB(connector{db})
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = previous
+	})
+	return db
+}
+
+// Calls returns every statement run so far
+func (db *DB) Calls() []Call {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Call(nil), db.calls...)
+}
+
+// Ran returns the statements containing substr
+func (db *DB) Ran(substr string) []Call {
+	var matched []Call
+	for _, c := range db.Calls() {
+		if strings.Contains(c.Query, substr) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+func (db *DB) run(query string, args []driver.NamedValue) Result {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	db.mu.Lock()
+	db.calls = append(db.calls, Call{Query: query, Args: values})
+	db.mu.Unlock()
+	if db.handler == nil {
+		return Result{}
+	}
+	return db.handler(query, values)
+}
+
+// Row builds a one-row result
+func Row(values ...driver.Value) Result {
+	return Result{Rows: [][]driver.Value{values}}
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn{c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, driver.ErrSkip }
+
+type conn struct{ db *DB }
+
+func (c conn) Prepare(query string) (driver.Stmt, error) { return stmt{c.db, query}, nil }
+func (c conn) Close() error                              { return nil }
+func (c conn) Begin() (driver.Tx, error)                 { return c.BeginTx(context.Background(), driver.TxOptions{}) }
+
+func (c conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if res := c.db.run("BEGIN", nil); res.Err != nil {
+		return nil, res.Err
+	}
+	return tx{c.db}, nil
+}
+
+// CheckNamedValue converts arguments like database/sql does, dereferencing
+// pointers and widening ints, but passes through the slices and other values
+// the pgx driver accepts instead of rejecting them
+func (c conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value); err == nil {
+		nv.Value = v
+	}
+	return nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.db.run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &rows{columns: res.Columns, values: res.Rows}, nil
+}
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.db.run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error   { return t.db.run("COMMIT", nil).Err }
+func (t tx) Rollback() error { return t.db.run("ROLLBACK", nil).Err }
+
+// stmt is only used by callers that prepare explicitly
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s stmt) Close() error  { return nil }
+func (s stmt) NumInput() int { return -1 }
+
+func (s stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return conn{s.db}.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return conn{s.db}.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	if r.columns == nil && len(r.values) > 0 {
+		return make([]string, len(r.values[0]))
+	}
+	return r.columns
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
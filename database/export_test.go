@@ -0,0 +1,8 @@
+package database
+
+// The database tests live in package database_test so they can use dbtest,
+// which imports this package; these expose the internals they exercise.
+var (
+	ConfigurePool = configurePool
+	CheckReplica  = checkReplica
+)
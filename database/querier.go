@@ -0,0 +1,14 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx, so helpers can run inside or
+// outside a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
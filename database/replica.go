@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/config"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Replica is the optional read-only pool; nil when no replica is configured
+var Replica *sql.DB
+
+var (
+	replicaHealthy    atomic.Bool
+	stopReplicaHealth context.CancelFunc
+)
+
+// Reader returns the pool for read-only queries that tolerate replication lag,
+// such as the catalog and order history. It falls back to the primary when no
+// replica is configured or the last health check failed. Writes, and reads that
+// must observe a write made in the same request, use DB directly.
+func Reader() *sql.DB {
+	if Replica != nil && replicaHealthy.Load() {
+		return Replica
+	}
+	return DB
+}
+
+// connectReplica opens the replica pool and starts its health checks. A replica
+// that is down at startup is not fatal; reads stay on the primary until it recovers.
+func connectReplica(cfg config.DatabaseConfig) {
+	var err error
+	Replica, err = open(cfg, cfg.ReplicaURL, "replica")
+	if err != nil {
+		slog.Error("Error opening read replica, reads will use the primary", "error", err)
+		Replica = nil
+		return
+	}
+
+	checkReplica()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopReplicaHealth = cancel
+	go func() {
+		ticker := time.NewTicker(cfg.ReplicaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkReplica()
+			}
+		}
+	}()
+}
+
+func checkReplica() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	healthy := Replica.PingContext(ctx) == nil
+	if previous := replicaHealthy.Swap(healthy); previous != healthy {
+		if healthy {
+			slog.Info("Read replica healthy, routing reads to it")
+		} else {
+			slog.Warn("Read replica unhealthy, routing reads to the primary")
+		}
+	}
+}
+
+func stopReplicaChecks() {
+	if stopReplicaHealth != nil {
+		stopReplicaHealth()
+	}
+}
@@ -0,0 +1,36 @@
+package database_test
+
+import (
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"testing"
+)
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	// dbtest.New installs its fake as database.DB, so the first one becomes
+	// the replica and the second the primary
+	dbtest.New(t, nil)
+	replica := database.DB
+	dbtest.New(t, nil)
+	primary := database.DB
+
+	previous := database.Replica
+	t.Cleanup(func() { database.Replica = previous })
+
+	database.Replica = nil
+	if database.Reader() != primary {
+		t.Error("Reader() without a replica configured is not the primary")
+	}
+
+	database.Replica = replica
+	database.CheckReplica()
+	if database.Reader() != replica {
+		t.Error("Reader() with a healthy replica is not the replica")
+	}
+
+	replica.Close()
+	database.CheckReplica()
+	if database.Reader() != primary {
+		t.Error("Reader() after a failed replica health check is not the primary")
+	}
+}
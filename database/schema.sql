@@ -1,8 +1,32 @@
+DROP TABLE IF EXISTS product_prices;
+DROP TABLE IF EXISTS product_imports;
+DROP TABLE IF EXISTS wishlist_items;
+DROP TABLE IF EXISTS wishlists;
+DROP TABLE IF EXISTS reviews;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS notification_opt_outs;
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS inventory_movements;
+DROP TABLE IF EXISTS shipment_items;
+DROP TABLE IF EXISTS shipments;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS cart_coupons;
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS payments;
 DROP TABLE IF EXISTS cart;
 DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_methods;
 DROP TABLE IF EXISTS products;
 DROP TABLE IF EXISTS users;
-DROP TABLE IF EXISTS payments;
 
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
@@ -10,18 +34,37 @@ CREATE TABLE users (
     email VARCHAR(255) UNIQUE NOT NULL,
     password TEXT NOT NULL,
     is_admin BOOLEAN DEFAULT FALSE,
+    locale VARCHAR(10) NOT NULL DEFAULT 'en',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE products (
     id SERIAL PRIMARY KEY,
+    sku VARCHAR(64) UNIQUE,
     name VARCHAR(255) NOT NULL,
     description TEXT,
     price DECIMAL(10,2) NOT NULL,
-    stock INT NOT NULL CHECK (stock >= 0),
+    -- running balance of inventory_movements, kept in step by the inventory service
+    stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    low_stock_threshold INT CHECK (low_stock_threshold >= 0),
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+    weight DECIMAL(10,3) NOT NULL DEFAULT 0 CHECK (weight >= 0),
+    -- totals over approved reviews, kept in step by the review service
+    rating_sum INT NOT NULL DEFAULT 0,
+    rating_count INT NOT NULL DEFAULT 0,
+    -- set when the product is archived; archived products are never hard-deleted
+    archived_at TIMESTAMPTZ,
+    -- bumped on every update; clients send it back in If-Match to avoid lost updates
+    version INT NOT NULL DEFAULT 1,
+    -- effective price in the last product.created or product.updated event, so
+    -- scheduled price jobs only announce real changes
+    announced_price DECIMAL(10,2),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX products_archived ON products (archived_at) WHERE archived_at IS NOT NULL;
+
 CREATE TABLE cart (
     id SERIAL PRIMARY KEY,
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
@@ -30,21 +73,341 @@ CREATE TABLE cart (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE shipping_methods (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    carrier VARCHAR(100) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a rate applies when weight and subtotal fall in [min, max); NULL max is unbounded
+CREATE TABLE shipping_rates (
+    id SERIAL PRIMARY KEY,
+    method_id INT REFERENCES shipping_methods(id) ON DELETE CASCADE,
+    min_weight DECIMAL(10,3) NOT NULL DEFAULT 0,
+    max_weight DECIMAL(10,3),
+    min_subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+    max_subtotal DECIMAL(10,2),
+    price DECIMAL(10,2) NOT NULL CHECK (price >= 0)
+);
+
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    subtotal DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (subtotal >= 0),
+    discount DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (discount >= 0),
+    coupon_code VARCHAR(50),
+    shipping_method_id INT REFERENCES shipping_methods(id),
+    shipping_cost DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (shipping_cost >= 0),
+    tax DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (tax >= 0),
     total DECIMAL(10,2) NOT NULL CHECK (total >= 0),
     status VARCHAR(20) NOT NULL DEFAULT 'Pending',
+    shipping_address JSONB,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- lets the expiry worker find stale unpaid orders without scanning history
+CREATE INDEX orders_not_paid ON orders (created_at) WHERE status = 'Not Paid';
+
 CREATE TABLE payments (
     id SERIAL PRIMARY KEY,
     user_id INT REFERENCES users(id) ON DELETE CASCADE,
     order_id INT REFERENCES orders(id) ON DELETE CASCADE,
     amount DECIMAL(10, 2) NOT NULL,
-    status VARCHAR(50) CHECK (status IN ('pending', 'completed', 'failed')) NOT NULL DEFAULT 'pending',
+    status VARCHAR(50) CHECK (status IN ('pending', 'completed', 'failed', 'expired')) NOT NULL DEFAULT 'pending',
     transaction_id VARCHAR(255) UNIQUE,
     payment_method VARCHAR(50),
     created_at TIMESTAMP DEFAULT NOW()
-);
\ No newline at end of file
+);
+
+CREATE TABLE idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    endpoint VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INT,
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    UNIQUE (user_id, endpoint, key)
+);
+
+CREATE TABLE order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INT REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INT REFERENCES products(id),
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10,2) NOT NULL,
+    discount DECIMAL(10,2) NOT NULL DEFAULT 0,
+    tax DECIMAL(10,2) NOT NULL DEFAULT 0,
+    line_total DECIMAL(10,2) NOT NULL
+);
+
+CREATE TABLE coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('percentage', 'fixed', 'free_shipping')),
+    value DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (value >= 0),
+    min_order_value DECIMAL(10,2) NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    max_uses INT,
+    max_uses_per_user INT,
+    used_count INT NOT NULL DEFAULT 0,
+    product_id INT REFERENCES products(id) ON DELETE CASCADE,
+    category VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE coupon_redemptions (
+    id SERIAL PRIMARY KEY,
+    coupon_id INT REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    order_id INT REFERENCES orders(id) ON DELETE CASCADE,
+    discount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE cart_coupons (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    coupon_id INT REFERENCES coupons(id) ON DELETE CASCADE,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tax_rates (
+    id SERIAL PRIMARY KEY,
+    country CHAR(2) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+    rate DECIMAL(6,4) NOT NULL CHECK (rate >= 0),
+    name VARCHAR(100),
+    UNIQUE (country, region, tax_class)
+);
+
+CREATE TABLE addresses (
+    id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    full_name VARCHAR(200) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code VARCHAR(20) NOT NULL,
+    country CHAR(2) NOT NULL,
+    phone VARCHAR(30) NOT NULL DEFAULT '',
+    is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+    is_default_billing BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- at most one default of each kind per user
+CREATE UNIQUE INDEX addresses_default_shipping ON addresses (user_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX addresses_default_billing ON addresses (user_id) WHERE is_default_billing;
+
+CREATE TABLE shipments (
+    id SERIAL PRIMARY KEY,
+    order_id INT REFERENCES orders(id) ON DELETE CASCADE,
+    carrier VARCHAR(100) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    shipped_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE shipment_items (
+    shipment_id INT REFERENCES shipments(id) ON DELETE CASCADE,
+    order_item_id INT REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    PRIMARY KEY (shipment_id, order_item_id)
+);
+
+CREATE TABLE inventory_movements (
+    id SERIAL PRIMARY KEY,
+    product_id INT REFERENCES products(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('receipt', 'sale', 'return', 'adjustment', 'reservation')),
+    quantity INT NOT NULL CHECK (quantity <> 0),
+    balance INT NOT NULL,
+    order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX inventory_movements_product ON inventory_movements (product_id, created_at);
+CREATE INDEX inventory_movements_order ON inventory_movements (order_id) WHERE order_id IS NOT NULL;
+
+-- durable background job queue; workers claim due rows with FOR UPDATE SKIP LOCKED
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL DEFAULT 'null',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMPTZ,
+    last_error TEXT,
+    unique_key VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX jobs_due ON jobs (run_at, id) WHERE status = 'pending';
+CREATE INDEX jobs_status ON jobs (status, updated_at);
+-- at most one queued instance per unique key, e.g. one run of each cron job
+CREATE UNIQUE INDEX jobs_unique_key ON jobs (unique_key) WHERE status IN ('pending', 'running');
+
+-- transactional outbox: written in the same transaction as the change, published by the relay
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    aggregate_type VARCHAR(50) NOT NULL,
+    aggregate_id VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    retry_at TIMESTAMPTZ,
+    dead_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_events_unpublished ON outbox_events (id) WHERE published_at IS NULL AND dead_at IS NULL;
+
+CREATE TABLE webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    event_types JSONB NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'retrying', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT,
+    response_body TEXT,
+    error TEXT,
+    last_attempt_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- the relay delivers at least once; this keeps one delivery per event and subscription
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE TABLE webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    response_status INT,
+    response_body TEXT,
+    error TEXT,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- one row per notification kind a user does not want to receive
+CREATE TABLE notification_opt_outs (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    PRIMARY KEY (user_id, kind)
+);
+
+-- email log; the relay delivers at least once, so one row per event, kind and recipient
+CREATE TABLE notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id INT REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INT REFERENCES products(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    event_id BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'skipped')),
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    UNIQUE (event_id, kind, user_id)
+);
+
+CREATE TABLE reviews (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, user_id)
+);
+
+CREATE INDEX reviews_product ON reviews (product_id, created_at DESC) WHERE status = 'approved';
+CREATE INDEX reviews_status ON reviews (status, created_at);
+
+CREATE TABLE wishlists (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    -- set while the list is shared by link
+    share_token VARCHAR(64) UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wishlists_user ON wishlists (user_id);
+
+CREATE TABLE wishlist_items (
+    wishlist_id INT NOT NULL REFERENCES wishlists(id) ON DELETE CASCADE,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    -- the price when added or last seen in a product event; a lower price triggers a price-drop email
+    notified_price DECIMAL(10,2) NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (wishlist_id, product_id)
+);
+
+CREATE INDEX wishlist_items_product ON wishlist_items (product_id);
+
+CREATE TABLE product_imports (
+    id SERIAL PRIMARY KEY,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'ndjson')),
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    total_rows INT NOT NULL DEFAULT 0,
+    -- progress of a background import, so a retried job resumes where it stopped
+    processed_rows INT NOT NULL DEFAULT 0,
+    created INT NOT NULL DEFAULT 0,
+    updated INT NOT NULL DEFAULT 0,
+    unchanged INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    -- the uploaded file, kept only until a background import completes
+    data BYTEA,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+-- btree_gist lets the exclusion constraint below compare product_id with =
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- scheduled sale prices; windows of one product never overlap
+CREATE TABLE product_prices (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sale_price DECIMAL(10,2) NOT NULL CHECK (sale_price > 0),
+    -- the original price shown next to the sale price; defaults to the list price
+    compare_at_price DECIMAL(10,2) CHECK (compare_at_price > 0),
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ CHECK (ends_at > starts_at),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- the pricing service checks this under the product lock to report 409;
+    -- the constraint also covers writes that bypass it. A NULL ends_at is open-ended.
+    EXCLUDE USING gist (product_id WITH =, tstzrange(starts_at, ends_at) WITH &&)
+);
+
+CREATE INDEX product_prices_product ON product_prices (product_id, starts_at);
@@ -0,0 +1,15 @@
+-- Sample data for local development. Run after schema.sql.
+
+INSERT INTO tax_rates (country, region, tax_class, rate, name) VALUES
+    ('US', '',   'standard', 0.0000, 'US default'),
+    ('US', 'CA', 'standard', 0.0725, 'California sales tax'),
+    ('US', 'NY', 'standard', 0.0400, 'New York sales tax'),
+    ('US', 'NY', 'clothing', 0.0000, 'New York clothing exemption'),
+    ('US', 'TX', 'standard', 0.0625, 'Texas sales tax'),
+    ('GB', '',   'standard', 0.2000, 'UK VAT'),
+    ('GB', '',   'reduced',  0.0500, 'UK reduced VAT'),
+    ('GB', '',   'zero',     0.0000, 'UK zero-rated'),
+    ('DE', '',   'standard', 0.1900, 'German VAT'),
+    ('DE', '',   'reduced',  0.0700, 'German reduced VAT'),
+    ('IN', '',   'standard', 0.1800, 'GST'),
+    ('IN', '',   'reduced',  0.0500, 'GST reduced');
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Message is one publication captured by MemoryBroker
+type Message struct {
+	Subject string
+	Data    []byte
+}
+
+// MemoryBroker keeps published messages in memory and fans them out to
+// subscribers. It stands in for a real broker in tests and local development.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	messages    []Message
+	subscribers map[string][]chan Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: map[string][]chan Message{}}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg := Message{Subject: subject, Data: append([]byte(nil), data...)}
+	b.messages = append(b.messages, msg)
+	for _, ch := range b.subscribers[subject] {
+		select {
+		case ch <- msg:
+		default: // a slow subscriber must not block the relay
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a buffered channel receiving future messages on subject
+func (b *MemoryBroker) Subscribe(subject string, buffer int) <-chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Message, buffer)
+	b.subscribers[subject] = append(b.subscribers[subject], ch)
+	return ch
+}
+
+// Messages returns everything published so far, in order
+func (b *MemoryBroker) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.messages...)
+}
+
+// NATSBroker publishes to a NATS server
+type NATSBroker struct {
+	conn *nats.Conn
+}
+
+func NewNATSBroker(url string) (*NATSBroker, error) {
+	conn, err := nats.Connect(url, nats.Name("e-commerce outbox relay"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	return &NATSBroker{conn: conn}, nil
+}
+
+// Publish waits for the server to acknowledge the flush, so a returned nil means
+// the message left this process rather than just sitting in the client buffer
+func (b *NATSBroker) Publish(ctx context.Context, subject string, data []byte) error {
+	if err := b.conn.Publish(subject, data); err != nil {
+		return err
+	}
+	return b.conn.FlushWithContext(ctx)
+}
+
+func (b *NATSBroker) Close() {
+	b.conn.Drain()
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"e-commerce/database"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Domain event types. Consumers should treat unknown types as forward compatible.
+const (
+	OrderCreated       = "order.created"
+	OrderStatusChanged = "order.status_changed"
+	PaymentSucceeded   = "payment.succeeded"
+	PaymentFailed      = "payment.failed"
+	ProductCreated     = "product.created"
+	ProductUpdated     = "product.updated"
+	ProductArchived    = "product.archived"
+	ProductRestored    = "product.restored"
+	ProductBackInStock = "product.back_in_stock"
+)
+
+// Types lists every event type, for validating subscriptions
+var Types = []string{OrderCreated, OrderStatusChanged, PaymentSucceeded, PaymentFailed, ProductCreated, ProductUpdated,
+	ProductArchived, ProductRestored, ProductBackInStock}
+
+// aliases maps an event type to the names it was published under before a
+// rename, so subscriptions listing an old name keep receiving it
+var aliases = map[string][]string{
+	ProductArchived: {"product.deleted"},
+}
+
+// Names returns eventType followed by its former names
+func Names(eventType string) []string {
+	return append([]string{eventType}, aliases[eventType]...)
+}
+
+// Known reports whether name is an event type or the former name of one
+func Known(name string) bool {
+	if slices.Contains(Types, name) {
+		return true
+	}
+	for _, old := range aliases {
+		if slices.Contains(old, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the envelope every sink receives. IDs increase in the order events
+// were recorded and double as idempotency keys, since delivery is at least once.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Data          json.RawMessage `json:"data"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// StatusChange is the data of an order.status_changed event
+type StatusChange struct {
+	OrderID int    `json:"order_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// StockChange is the data of a product.back_in_stock event
+type StockChange struct {
+	ProductID int `json:"product_id"`
+	Stock     int `json:"stock"`
+}
+
+// Record writes an event to the outbox. q must be the transaction making the
+// change the event describes, so the event exists exactly when the change does.
+func Record(ctx context.Context, q database.Querier, eventType, aggregateType string, aggregateID int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("encoding %s event: %w", eventType, err)
+	}
+	query := "INSERT INTO outbox_events (type, aggregate_type, aggregate_id, data) VALUES ($1, $2, $3, $4)"
+	_, err = q.ExecContext(ctx, query, eventType, aggregateType, strconv.Itoa(aggregateID), payload)
+	return err
+}
+
+// RecordStatusChange records an order.status_changed event when the status
+// actually changed
+func RecordStatusChange(ctx context.Context, q database.Querier, orderID int, from, to string) error {
+	if from == to {
+		return nil
+	}
+	return Record(ctx, q, OrderStatusChanged, "order", orderID, StatusChange{OrderID: orderID, From: from, To: to})
+}
@@ -0,0 +1,23 @@
+package events
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRenamedTypesKeepTheirOldNames(t *testing.T) {
+	if got := Names(ProductArchived); !slices.Equal(got, []string{"product.archived", "product.deleted"}) {
+		t.Errorf("Names(product.archived) = %v", got)
+	}
+	if got := Names(OrderCreated); !slices.Equal(got, []string{OrderCreated}) {
+		t.Errorf("Names(order.created) = %v", got)
+	}
+	for _, name := range []string{ProductArchived, "product.deleted", OrderCreated} {
+		if !Known(name) {
+			t.Errorf("Known(%q) = false", name)
+		}
+	}
+	if Known("product.exploded") {
+		t.Error("unknown type accepted")
+	}
+}
@@ -0,0 +1,167 @@
+package events
+
+import (
+	"context"
+	"e-commerce/database"
+	"e-commerce/logging"
+	"e-commerce/metrics"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Relay moves committed events from the outbox to the sinks. Delivery is at
+// least once: an event is marked published only after every sink accepted it,
+// so a failure in one sink redelivers the event to all of them.
+type Relay struct {
+	Sinks     []Sink
+	Interval  time.Duration
+	BatchSize int
+	Timeout   time.Duration
+	// A failed event is retried after Backoff, doubling per attempt up to
+	// MaxBackoff; after MaxAttempts it is dead-lettered so later events flow again
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Start polls the outbox every Interval until the returned function is called;
+// that function waits for a batch in progress to finish
+func (r *Relay) Start() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			// keep draining while batches come back full
+			for {
+				n, err := r.RelayBatch(ctx)
+				if err != nil && ctx.Err() == nil {
+					slog.Error("Relaying outbox events failed", "error", err)
+				}
+				if err != nil || n < r.BatchSize {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// pendingEvent is an outbox row with its delivery state
+type pendingEvent struct {
+	Event
+	attempts int
+	// waiting is set while a failed event's retry time has not come yet
+	waiting bool
+}
+
+// RelayBatch publishes up to BatchSize unpublished events in id order and
+// returns how many it handled. The rows stay locked until the batch commits, so
+// concurrent relays skip them instead of publishing them twice. It stops at the
+// first failing event, and at an event waiting for its retry, so later events
+// are never delivered ahead of it; only a dead-lettered event is skipped.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, type, aggregate_type, aggregate_id, data, occurred_at, attempts, COALESCE(retry_at > NOW(), FALSE)
+		FROM outbox_events WHERE published_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var batch []pendingEvent
+	for rows.Next() {
+		var e pendingEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &e.Data, &e.OccurredAt, &e.attempts, &e.waiting); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	var publishErr error
+	for _, e := range batch {
+		if e.waiting {
+			break
+		}
+		if err := r.publish(ctx, e.Event); err != nil {
+			attempts := e.attempts + 1
+			if r.MaxAttempts > 0 && attempts >= r.MaxAttempts {
+				query := "UPDATE outbox_events SET attempts=$2, last_error=$3, dead_at=NOW() WHERE id=$1"
+				if _, err := tx.ExecContext(ctx, query, e.ID, attempts, err.Error()); err != nil {
+					return handled, err
+				}
+				metrics.EventsDeadLettered.Inc()
+				logging.FromContext(ctx).Error("Outbox event dead-lettered", "event_id", e.ID, "type", e.Type, "attempts", attempts, "error", err)
+				handled++
+				continue
+			}
+			publishErr = err
+			query := "UPDATE outbox_events SET attempts=$2, last_error=$3, retry_at=NOW() + make_interval(secs => $4) WHERE id=$1"
+			if _, err := tx.ExecContext(ctx, query, e.ID, attempts, err.Error(), r.backoff(attempts).Seconds()); err != nil {
+				return handled, err
+			}
+			break
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE outbox_events SET published_at=NOW(), last_error=NULL WHERE id=$1", e.ID); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return handled, publishErr
+}
+
+// backoff is the wait before retrying an event that has failed attempts times
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if r.MaxBackoff > 0 && delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
+
+func (r *Relay) publish(ctx context.Context, e Event) error {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	var errs []error
+	for _, sink := range r.Sinks {
+		if err := sink.Publish(ctx, e); err != nil {
+			metrics.EventsPublished.WithLabelValues(sink.Name(), "error").Inc()
+			errs = append(errs, errors.New(sink.Name()+": "+err.Error()))
+			continue
+		}
+		metrics.EventsPublished.WithLabelValues(sink.Name(), "ok").Inc()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyBroker fails every publication on the failing subjects
+type flakyBroker struct {
+	*MemoryBroker
+	failing map[string]bool
+}
+
+func (b flakyBroker) Publish(ctx context.Context, subject string, data []byte) error {
+	if b.failing[subject] {
+		return errors.New("broker unavailable")
+	}
+	return b.MemoryBroker.Publish(ctx, subject, data)
+}
+
+// outboxRow is an unpublished event as the relay selects it
+func outboxRow(id int64, eventType string, attempts int64, waiting bool) []driver.Value {
+	return []driver.Value{id, eventType, "order", "42", []byte(`{"order_id":42}`), time.Now(), attempts, waiting}
+}
+
+func newRelay(t *testing.T, rows [][]driver.Value, failing ...string) (*Relay, *MemoryBroker, *dbtest.DB) {
+	t.Helper()
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "FROM outbox_events") {
+			return dbtest.Result{Rows: rows}
+		}
+		return dbtest.Result{RowsAffected: 1}
+	})
+	broker := NewMemoryBroker()
+	flaky := flakyBroker{MemoryBroker: broker, failing: map[string]bool{}}
+	for _, subject := range failing {
+		flaky.failing[subject] = true
+	}
+	relay := &Relay{
+		Sinks:       []Sink{BrokerSink{Broker: flaky}},
+		BatchSize:   10,
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+	}
+	return relay, broker, db
+}
+
+func subjects(b *MemoryBroker) []string {
+	var list []string
+	for _, m := range b.Messages() {
+		list = append(list, m.Subject)
+	}
+	return list
+}
+
+func TestRelayBatchPublishesInOrder(t *testing.T) {
+	relay, broker, db := newRelay(t, [][]driver.Value{
+		outboxRow(1, OrderCreated, 0, false),
+		outboxRow(2, OrderStatusChanged, 0, false),
+	})
+
+	n, err := relay.RelayBatch(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("RelayBatch = %d, %v, want 2 handled", n, err)
+	}
+	if got := strings.Join(subjects(broker), ","); got != "order.created,order.status_changed" {
+		t.Errorf("published %s", got)
+	}
+	if len(db.Ran("SET published_at=NOW()")) != 2 || len(db.Ran("COMMIT")) != 1 {
+		t.Error("events were not marked published in one transaction")
+	}
+}
+
+func TestRelayBatchRetriesFailingEventWithBackoff(t *testing.T) {
+	relay, broker, db := newRelay(t, [][]driver.Value{
+		outboxRow(1, OrderCreated, 1, false),
+		outboxRow(2, OrderStatusChanged, 0, false),
+	}, OrderCreated)
+
+	n, err := relay.RelayBatch(context.Background())
+	if err == nil || n != 0 {
+		t.Fatalf("RelayBatch = %d, %v, want the publish error and nothing handled", n, err)
+	}
+	if len(broker.Messages()) != 0 {
+		t.Errorf("published %v ahead of the failing event", subjects(broker))
+	}
+	retries := db.Ran("retry_at=NOW()")
+	if len(retries) != 1 {
+		t.Fatalf("scheduled %d retries, want 1", len(retries))
+	}
+	// second failure: the base backoff doubled once
+	if args := retries[0].Args; args[1] != int64(2) || args[3] != float64(2) {
+		t.Errorf("retry args = %v, want attempt 2 in 2s", args)
+	}
+}
+
+func TestRelayBatchDeadLettersExhaustedEvent(t *testing.T) {
+	relay, broker, db := newRelay(t, [][]driver.Value{
+		outboxRow(1, OrderCreated, 2, false),
+		outboxRow(2, OrderStatusChanged, 0, false),
+	}, OrderCreated)
+
+	n, err := relay.RelayBatch(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("RelayBatch = %d, %v, want both events handled", n, err)
+	}
+	dead := db.Ran("dead_at=NOW()")
+	if len(dead) != 1 || dead[0].Args[0] != int64(1) {
+		t.Fatalf("dead-lettered %v, want event 1", dead)
+	}
+	if got := strings.Join(subjects(broker), ","); got != "order.status_changed" {
+		t.Errorf("published %q, want the event after the dead one", got)
+	}
+}
+
+func TestRelayBatchWaitsForRetryTime(t *testing.T) {
+	relay, broker, db := newRelay(t, [][]driver.Value{
+		outboxRow(1, OrderCreated, 1, true),
+		outboxRow(2, OrderStatusChanged, 0, false),
+	})
+
+	n, err := relay.RelayBatch(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("RelayBatch = %d, %v, want nothing handled", n, err)
+	}
+	if len(broker.Messages()) != 0 || len(db.Ran("UPDATE outbox_events")) != 0 {
+		t.Error("relayed past an event waiting for its retry")
+	}
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"e-commerce/logging"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Sink is a destination the relay publishes committed events to
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, e Event) error
+}
+
+// LogSink writes each event to the structured log; useful in development and as
+// an audit trail
+type LogSink struct{}
+
+func (LogSink) Name() string { return "log" }
+
+func (LogSink) Publish(ctx context.Context, e Event) error {
+	logging.FromContext(ctx).Info("domain event", "event_id", e.ID, "event_type", e.Type,
+		"aggregate_type", e.AggregateType, "aggregate_id", e.AggregateID, "data", e.Data)
+	return nil
+}
+
+// HTTPSink POSTs each event as JSON to a fixed URL. Any non-2xx response is a
+// failure and the event is retried on the next relay pass.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s HTTPSink) Name() string { return "http" }
+
+func (s HTTPSink) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", e.Type)
+	req.Header.Set("X-Event-ID", strconv.FormatInt(e.ID, 10))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// Broker is the minimal publish interface of a message broker such as NATS or
+// Kafka. MemoryBroker implements it for tests and local runs.
+type Broker interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+// BrokerSink publishes each event to "<prefix>.<event type>", e.g.
+// "ecommerce.order.created"
+type BrokerSink struct {
+	Broker Broker
+	Prefix string
+}
+
+func (s BrokerSink) Name() string { return "broker" }
+
+func (s BrokerSink) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.Broker.Publish(ctx, Subject(s.Prefix, e.Type), data)
+}
+
+// Subject is the broker subject an event type is published on
+func Subject(prefix, eventType string) string {
+	if prefix == "" {
+		return eventType
+	}
+	return strings.TrimSuffix(prefix, ".") + "." + eventType
+}
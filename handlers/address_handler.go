@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func ListAddresses(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	addresses, err := services.ListAddresses(ctx, userID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addresses)
+}
+
+func GetAddress(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	address, err := services.GetAddress(ctx, database.DB, userID, addressID)
+	if err != nil {
+		if errors.Is(err, services.ErrAddressNotFound) {
+			http.Error(w, "Address not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(address)
+}
+
+func CreateAddress(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	var req models.AddressRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	address := addressFromRequest(req)
+	address.UserID = userID
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.SaveAddress(ctx, &address); err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(address)
+}
+
+func UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AddressRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	address := addressFromRequest(req)
+	address.ID = addressID
+	address.UserID = userID
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.SaveAddress(ctx, &address); err != nil {
+		if errors.Is(err, services.ErrAddressNotFound) {
+			http.Error(w, "Address not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(address)
+}
+
+func DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.DeleteAddress(ctx, userID, addressID); err != nil {
+		if errors.Is(err, services.ErrAddressNotFound) {
+			http.Error(w, "Address not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func addressFromRequest(req models.AddressRequest) models.Address {
+	return models.Address{
+		FullName:          req.FullName,
+		Line1:             req.Line1,
+		Line2:             req.Line2,
+		City:              req.City,
+		Region:            req.Region,
+		PostalCode:        req.PostalCode,
+		Country:           req.Country,
+		Phone:             req.Phone,
+		IsDefaultShipping: req.IsDefaultShipping,
+		IsDefaultBilling:  req.IsDefaultBilling,
+	}
+}
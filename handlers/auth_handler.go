@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"e-commerce/database"
 	"e-commerce/models"
+	"e-commerce/notifications"
 	"e-commerce/utils"
 	"encoding/json"
 	"net/http"
@@ -11,32 +12,43 @@ import (
 )
 
 func RegisterUser(w http.ResponseWriter, r *http.Request){
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid Request", http.StatusBadRequest)
+	var req models.RegisterRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if req.Locale == "" {
+		req.Locale = notifications.DefaultLocale
+	} else if !notifications.SupportedLocale(req.Locale) {
+		http.Error(w, "Unsupported locale", http.StatusUnprocessableEntity)
 		return
 	}
 
-	hashedPassword, err := utils.HashPassword(user.Password)
+	// accounts always register as customers; admins are promoted in the database
+	user := models.User{Username: req.Username, Email: req.Email}
+	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		serverError(w, r, "Error hashing password", err)
         return
 	}
 
-	query := "INSERT INTO users (username, email, password, is_admin) VALUES ($1, $2, $3, $4) RETURNING id"
-	err = database.DB.QueryRow(query, user.Username, user.Email, hashedPassword, user.IsAdmin).Scan(&user.ID)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	query := "INSERT INTO users (username, email, password, locale) VALUES ($1, $2, $3, $4) RETURNING id"
+	err = database.DB.QueryRowContext(ctx, query, user.Username, user.Email, hashedPassword, req.Locale).Scan(&user.ID)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate key value violates unique constraint"){
 			http.Error(w, "Email already exists in the database", http.StatusConflict)
 		} else{
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
 
 	token, err := utils.GenerateToken(user.ID, user.IsAdmin)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		serverError(w, r, "Error generating token", err)
         return
 	}
 
@@ -47,20 +59,22 @@ func RegisterUser(w http.ResponseWriter, r *http.Request){
 }
 
 func LoginUser(w http.ResponseWriter, r *http.Request){
-	var creds models.User
-	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-		http.Error(w, "Invalid Request", http.StatusBadRequest)
+	var creds models.LoginRequest
+	if !decodeAndValidate(w, r, &creds) {
 		return
 	}
 
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
 	var user models.User
 	query := "SELECT id, password, is_admin FROM users WHERE email=$1"
-	err := database.DB.QueryRow(query, creds.Email).Scan(&user.ID, &user.Password, &user.IsAdmin)
+	err := database.DB.QueryRowContext(ctx, query, creds.Email).Scan(&user.ID, &user.Password, &user.IsAdmin)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
@@ -72,7 +86,7 @@ func LoginUser(w http.ResponseWriter, r *http.Request){
 
 	token, err := utils.GenerateToken(user.ID, user.IsAdmin)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		serverError(w, r, "Error generating token", err)
         return
 	}
 
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"e-commerce/config"
+	"e-commerce/database/dbtest"
+	"e-commerce/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterUserIgnoresAdminFlag(t *testing.T) {
+	utils.ConfigureTokens(config.AuthConfig{JWTSecret: "test-secret", TokenTTL: time.Hour})
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "INSERT INTO users") {
+			return dbtest.Row(int64(5))
+		}
+		return dbtest.Result{}
+	})
+
+	w := httptest.NewRecorder()
+	body := `{"username": "mallory", "email": "mallory@example.com", "password": "hunter22", "isadmin": true}`
+	RegisterUser(w, httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	inserts := db.Ran("INSERT INTO users")
+	if len(inserts) != 1 || strings.Contains(inserts[0].Query, "is_admin") {
+		t.Fatalf("user inserts = %v, want one leaving is_admin to its default", inserts)
+	}
+	var resp struct{ Token string }
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, isAdmin, err := utils.ValidateToken(resp.Token); err != nil || isAdmin {
+		t.Errorf("token admin = %v (err %v), want a customer token", isAdmin, err)
+	}
+}
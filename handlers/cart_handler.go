@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"e-commerce/database"
+	"e-commerce/metrics"
 	"e-commerce/middleware"
 	"github.com/gorilla/mux"
 	"e-commerce/models"
+	"e-commerce/services"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -18,20 +21,31 @@ func AddToCart(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := user.(int)
 
-	var cartItem models.Cart
-	if err := json.NewDecoder(r.Body).Decode(&cartItem); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req models.AddToCartRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	query := "INSERT INTO cart (user_id, product_id, quantity) VALUES ($1, $2, $3) RETURNING id, created_at"
-	err := database.DB.QueryRow(query, userID, cartItem.ProductID, cartItem.Quantity).Scan(&cartItem.ID, &cartItem.CreatedAt)
+	cartItem := models.Cart{ProductID: req.ProductID, Quantity: req.Quantity}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	// archived products can no longer be bought
+	query := `INSERT INTO cart (user_id, product_id, quantity)
+		SELECT $1, id, $3 FROM products WHERE id=$2 AND archived_at IS NULL RETURNING id, created_at`
+	err := database.DB.QueryRowContext(ctx, query, userID, cartItem.ProductID, cartItem.Quantity).Scan(&cartItem.ID, &cartItem.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		serverError(w, r, "Database error", err)
 		return
 	}
 
 	cartItem.UserID = userID
+	metrics.CartAdds.Inc()
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(cartItem)
@@ -45,10 +59,16 @@ func ViewCart(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := user.(int)
 
-	query := "SELECT id, user_id, product_id, quantity, created_at FROM cart WHERE user_id=$1"
-	rows, err := database.DB.Query(query, userID)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	// lines are priced like checkout prices them, so sales show up in the cart
+	query := `SELECT c.id, c.user_id, c.product_id, c.quantity, ` + services.EffectivePrice + `, ` + services.CompareAtPrice + `, c.created_at
+		FROM cart c JOIN products p ON p.id = c.product_id ` + services.SaleJoin + `
+		WHERE c.user_id=$1 ORDER BY c.id`
+	rows, err := database.DB.QueryContext(ctx, query, userID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		serverError(w, r, "Database error", err)
 		return
 	}
 	defer rows.Close()
@@ -56,8 +76,8 @@ func ViewCart(w http.ResponseWriter, r *http.Request) {
 	var cartItems []models.Cart
 	for rows.Next() {
 		var cartItem models.Cart
-		if err := rows.Scan(&cartItem.ID, &cartItem.UserID, &cartItem.ProductID, &cartItem.Quantity, &cartItem.CreatedAt); err != nil {
-			http.Error(w, "Error scanning cart items", http.StatusInternalServerError)
+		if err := rows.Scan(&cartItem.ID, &cartItem.UserID, &cartItem.ProductID, &cartItem.Quantity, &cartItem.UnitPrice, &cartItem.CompareAtPrice, &cartItem.CreatedAt); err != nil {
+			serverError(w, r, "Error scanning cart items", err)
 			return
 		}
 		cartItems = append(cartItems, cartItem)
@@ -92,11 +112,14 @@ func RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
 	query := "DELETE FROM cart WHERE user_id=$1 AND product_id=$2"
-	res, err := database.DB.Exec(query, userID, productID)
+	res, err := database.DB.ExecContext(ctx, query, userID, productID)
 
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		serverError(w, r, "Database error", err)
 		return
 	}
 
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ADMIN ONLY: create a coupon
+func CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req models.CouponRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.Type == models.CouponPercentage && req.Value > 100 {
+		http.Error(w, "Percentage coupons cannot exceed 100", http.StatusUnprocessableEntity)
+		return
+	}
+	if req.Type != models.CouponFreeShipping && req.Value <= 0 {
+		http.Error(w, "Percentage and fixed coupons need a positive value", http.StatusUnprocessableEntity)
+		return
+	}
+
+	coupon := models.Coupon{
+		Code:           services.NormalizeCouponCode(req.Code),
+		Type:           req.Type,
+		Value:          req.Value,
+		MinOrderValue:  req.MinOrderValue,
+		ExpiresAt:      req.ExpiresAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		ProductID:      req.ProductID,
+		Category:       req.Category,
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.CreateCoupon(ctx, &coupon); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			http.Error(w, "Coupon code already exists", http.StatusConflict)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// ADMIN ONLY: list coupons with their usage
+func ListCoupons(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	coupons, err := services.ListCoupons(ctx)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+// ApplyCoupon attaches a code to the user's cart after checking it against the
+// current cart, and returns the resulting discount preview
+func ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	var req models.ApplyCouponRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	coupon, err := services.FindCouponByCode(ctx, database.DB, req.Code)
+	if err != nil {
+		if services.IsCouponError(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	lines, err := services.CartLines(ctx, database.DB, userID)
+	if err != nil {
+		serverError(w, r, "Failed to fetch cart items", err)
+		return
+	}
+	if len(lines) == 0 {
+		http.Error(w, "Cart is empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.CheckCouponEligibility(ctx, database.DB, coupon, userID, lines); err != nil {
+		if services.IsCouponError(err) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	if err := services.AttachCouponToCart(ctx, userID, coupon.ID); err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	discount := services.ApplyCouponDiscount(coupon, lines)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Code         string  `json:"code"`
+		Type         string  `json:"type"`
+		Subtotal     float64 `json:"subtotal"`
+		Discount     float64 `json:"discount"`
+		FreeShipping bool    `json:"free_shipping"`
+	}{
+		Code:         coupon.Code,
+		Type:         coupon.Type,
+		Subtotal:     services.CartSubtotal(lines),
+		Discount:     discount,
+		FreeShipping: coupon.Type == models.CouponFreeShipping,
+	})
+}
+
+func RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	removed, err := services.DetachCouponFromCart(ctx, database.DB, userID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+	if !removed {
+		http.Error(w, "No coupon applied to cart", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
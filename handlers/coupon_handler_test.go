@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"e-commerce/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateCouponRejectsZeroValue(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	for _, body := range []string{
+		`{"code": "NOTHING", "type": "fixed", "value": 0}`,
+		`{"code": "NOTHING", "type": "percentage"}`,
+	} {
+		w := httptest.NewRecorder()
+		CreateCoupon(w, request(http.MethodPost, "/api/admin/coupons", body, 1, true, nil))
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d, want 422", body, w.Code)
+		}
+	}
+	if len(db.Calls()) != 0 {
+		t.Errorf("stored a coupon without a value")
+	}
+}
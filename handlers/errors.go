@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"e-commerce/logging"
+	"net/http"
+)
+
+// serverError logs the underlying error with the request-scoped logger and
+// returns a generic 500 so internals never reach the client
+func serverError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logging.FromContext(r.Context()).Error(msg, "error", err)
+	http.Error(w, msg, http.StatusInternalServerError)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"context"
+	"e-commerce/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// request builds a request as the auth middleware would pass it on, for
+// userID and with the route variables set
+func request(method, target, body string, userID int, admin bool, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	ctx := context.WithValue(r.Context(), middleware.UserIDKey, userID)
+	ctx = context.WithValue(ctx, middleware.IsAdminKey, admin)
+	r = r.WithContext(ctx)
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	return r
+}
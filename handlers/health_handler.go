@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"e-commerce/database"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var draining atomic.Bool
+
+// MarkDraining makes /readyz fail so the orchestrator stops routing new traffic
+// while in-flight requests finish
+func MarkDraining() {
+	draining.Store(true)
+}
+
+// Healthz reports liveness: the process is up and serving HTTP
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// Readyz reports readiness: Postgres is reachable and the server is not shutting down
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := database.DB.PingContext(ctx); err != nil {
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ready"))
+}
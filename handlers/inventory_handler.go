@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultMovementLimit = 50
+	maxMovementLimit     = 500
+)
+
+// ADMIN ONLY: record a receipt, return or adjustment against a product's stock
+func RecordStockMovement(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(int)
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.StockMovementRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.Kind != models.MovementAdjustment && req.Quantity < 0 {
+		http.Error(w, "Receipts and returns must have a positive quantity", http.StatusUnprocessableEntity)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	movement := models.InventoryMovement{ProductID: productID, Kind: req.Kind, Quantity: req.Quantity, Note: req.Note, CreatedBy: &adminID}
+	if err := services.AdjustStock(ctx, &movement); err != nil {
+		switch {
+		case errors.Is(err, services.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrInsufficientStock):
+			http.Error(w, "Adjustment would make stock negative", http.StatusConflict)
+		default:
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+// ADMIN ONLY: a product's stock ledger, newest first; ?limit= caps the entries
+func StockHistory(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultMovementLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxMovementLimit {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	movements, err := services.StockMovements(ctx, productID, limit)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// ADMIN ONLY: products at or below their low-stock threshold
+func LowStockProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	products, err := services.LowStockProducts(ctx)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/jobs"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const jobListLimit = 100
+
+// ADMIN ONLY: list background jobs by ?status= (pending, running, done or dead;
+// defaults to dead so failures are easy to find)
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = jobs.StatusDead
+	case jobs.StatusPending, jobs.StatusRunning, jobs.StatusDone, jobs.StatusDead:
+	default:
+		http.Error(w, "status must be one of pending, running, done, dead", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := jobs.List(ctx, status, jobListLimit)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ADMIN ONLY: requeue a dead-lettered job with a fresh set of attempts
+func RetryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	job, err := jobs.Retry(ctx, id)
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			http.Error(w, "Dead job not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
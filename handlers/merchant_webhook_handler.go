@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const deliveryListLimit = 100
+
+// webhookFromRequest validates the URL and event types shared by create and update
+func webhookFromRequest(w http.ResponseWriter, req models.WebhookSubscriptionRequest) (models.WebhookSubscription, bool) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		http.Error(w, "url must be an absolute http or https URL", http.StatusUnprocessableEntity)
+		return models.WebhookSubscription{}, false
+	}
+	for _, t := range req.EventTypes {
+		if t != "*" && !events.Known(t) {
+			http.Error(w, fmt.Sprintf("Unknown event type %q", t), http.StatusUnprocessableEntity)
+			return models.WebhookSubscription{}, false
+		}
+	}
+
+	sub := models.WebhookSubscription{URL: req.URL, EventTypes: req.EventTypes, Secret: req.Secret, Active: true}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	return sub, true
+}
+
+// webhookWithSecret is the create response, the only place the secret is shown
+type webhookWithSecret struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// ADMIN ONLY: subscribe a URL to domain events
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.WebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	sub, ok := webhookFromRequest(w, req)
+	if !ok {
+		return
+	}
+	if sub.Secret == "" {
+		secret, err := services.NewWebhookSecret()
+		if err != nil {
+			serverError(w, r, "Failed to generate secret", err)
+			return
+		}
+		sub.Secret = secret
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.CreateWebhook(ctx, &sub); err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhookWithSecret{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// ADMIN ONLY: list webhook subscriptions
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	subs, err := services.ListWebhooks(ctx)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// ADMIN ONLY: replace a subscription; omit secret to keep the current one
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.WebhookSubscriptionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	sub, ok := webhookFromRequest(w, req)
+	if !ok {
+		return
+	}
+	sub.ID = id
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.UpdateWebhook(ctx, &sub); err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// ADMIN ONLY: delete a subscription and its delivery log
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.DeleteWebhook(ctx, id); err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ADMIN ONLY: a subscription's most recent deliveries
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	deliveries, err := services.WebhookDeliveries(ctx, id, deliveryListLimit)
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ADMIN ONLY: one delivery with the log of every attempt
+func GetWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	delivery, err := services.WebhookDelivery(ctx, id)
+	if err != nil {
+		if errors.Is(err, services.ErrDeliveryNotFound) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// ADMIN ONLY: send a finished delivery again with a fresh set of attempts
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	delivery, err := services.Redeliver(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDeliveryNotFound):
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrDeliveryInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
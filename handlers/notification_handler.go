@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/notifications"
+	"e-commerce/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	prefs, err := services.NotificationPreferences(ctx, userID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdateNotificationPreferences replaces the locale and the full opt-out list
+func UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	var req models.NotificationPreferencesRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if !notifications.SupportedLocale(req.Locale) {
+		http.Error(w, "Unsupported locale", http.StatusUnprocessableEntity)
+		return
+	}
+	for _, kind := range req.OptOuts {
+		if !slices.Contains(notifications.Kinds, kind) {
+			http.Error(w, fmt.Sprintf("Unknown notification kind %q", kind), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	prefs := models.NotificationPreferences{Locale: req.Locale, OptOuts: req.OptOuts}
+	if prefs.OptOuts == nil {
+		prefs.OptOuts = []string{}
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.SetNotificationPreferences(ctx, userID, prefs); err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"e-commerce/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdateNotificationPreferencesOptOuts(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	w := httptest.NewRecorder()
+	body := `{"locale": "es", "opt_outs": ["order_shipped", "payment_failed"]}`
+	UpdateNotificationPreferences(w, request(http.MethodPut, "/api/notifications/preferences", body, 7, false, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	inserts := db.Ran("INSERT INTO notification_opt_outs")
+	if len(inserts) != 2 {
+		t.Fatalf("inserted %d opt-outs, want 2", len(inserts))
+	}
+	for i, kind := range []string{"order_shipped", "payment_failed"} {
+		if got := inserts[i].Args[1]; got != kind {
+			t.Errorf("opt-out %d = %v, want %s", i, got, kind)
+		}
+	}
+	if len(db.Ran("COMMIT")) != 1 {
+		t.Error("preferences were not committed")
+	}
+}
+
+func TestUpdateNotificationPreferencesRejectsUnknownKind(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	w := httptest.NewRecorder()
+	body := `{"locale": "en", "opt_outs": ["newsletter"]}`
+	UpdateNotificationPreferences(w, request(http.MethodPut, "/api/notifications/preferences", body, 7, false, nil))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if len(db.Calls()) != 0 {
+		t.Errorf("ran %d statements for a rejected request", len(db.Calls()))
+	}
+}
@@ -3,9 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"e-commerce/database"
+	"e-commerce/metrics"
 	"e-commerce/middleware"
 	"e-commerce/models"
+	"e-commerce/services"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -20,57 +23,34 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
     }
     userID := user.(int)
 
-    rows, err := database.DB.Query("SELECT product_id, quantity FROM cart WHERE user_id=$1", userID)
-    if err != nil {
-        http.Error(w, "Failed to fetch cart items", http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var total float64
-    var cartItems []models.Cart
-
-    for rows.Next() {
-        var cartItem models.Cart
-        if err := rows.Scan(&cartItem.ProductID, &cartItem.Quantity); err != nil {
-            http.Error(w, "Error scanning cart items", http.StatusInternalServerError)
-            return
-        }
-
-        var price float64
-        err := database.DB.QueryRow("SELECT price FROM products WHERE id=$1", cartItem.ProductID).Scan(&price)
-        if err != nil {
-            http.Error(w, "Failed to fetch product price", http.StatusInternalServerError)
-            return
-        }
-
-        total += price * float64(cartItem.Quantity)
-        cartItems = append(cartItems, cartItem)
-    }
-
-    if len(cartItems) == 0 {
-        http.Error(w, "Cart is empty", http.StatusBadRequest)
+    var req models.CreateOrderRequest
+    if !decodeAndValidate(w, r, &req) {
         return
     }
 
-    var order models.Orders
-    query := "INSERT INTO orders (user_id, total, status) VALUES ($1, $2, $3) RETURNING id, created_at"
-    err = database.DB.QueryRow(query, userID, total, "Not Paid").Scan(&order.ID, &order.CreatedAt)
-    if err != nil {
-        http.Error(w, "Failed to create order", http.StatusInternalServerError)
-        return
-    }
+    ctx, cancel := database.WithTimeout(r.Context())
+    defer cancel()
 
-    // Clear the user's cart after the order is placed
-    _, err = database.DB.Exec("DELETE FROM cart WHERE user_id=$1", userID)
+    order, err := services.PlaceOrder(ctx, userID, req)
     if err != nil {
-        http.Error(w, "Failed to clear cart", http.StatusInternalServerError)
+        switch {
+        case errors.Is(err, services.ErrCartEmpty):
+            http.Error(w, "Cart is empty", http.StatusBadRequest)
+        case errors.Is(err, services.ErrAddressNotFound), errors.Is(err, services.ErrNoDefaultShipping):
+            http.Error(w, err.Error(), http.StatusBadRequest)
+        case errors.Is(err, services.ErrInsufficientStock):
+            http.Error(w, err.Error(), http.StatusConflict)
+        case errors.Is(err, services.ErrShippingMethodUnavailable):
+            http.Error(w, err.Error(), http.StatusBadRequest)
+        case services.IsCouponError(err):
+            http.Error(w, fmt.Sprintf("Coupon cannot be applied: %v", err), http.StatusBadRequest)
+        default:
+            serverError(w, r, "Failed to create order", err)
+        }
         return
     }
 
-    order.UserID = userID
-    order.Total = total
-    order.Status = "Not Paid"
+    metrics.OrdersCreated.Inc()
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(order)
@@ -85,10 +65,15 @@ func ViewOrders(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := user.(int)
 
-	query := "SELECT id, user_id, total, status, created_at FROM orders WHERE user_id=$1"
-	rows, err := database.DB.Query(query, userID)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	// order history tolerates replica lag; the details view stays on the primary
+	// because it is usually opened right after checkout
+	query := "SELECT " + services.OrderColumns + " FROM orders WHERE user_id=$1"
+	rows, err := database.Reader().QueryContext(ctx, query, userID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		serverError(w, r, "Database error", err)
 		return
 	}
 	defer rows.Close()
@@ -96,7 +81,7 @@ func ViewOrders(w http.ResponseWriter, r *http.Request) {
 	var orders []models.Orders
 	for rows.Next() {
 		var order models.Orders
-		if err := rows.Scan(&order.ID, &order.UserID, &order.Total, &order.Status, &order.CreatedAt); err != nil {
+		if err := services.ScanOrder(rows, &order); err != nil {
 			continue
 		}
 		orders = append(orders, order)
@@ -131,19 +116,28 @@ func ViewOrderDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
 	var order models.Orders
-	query := "SELECT id, user_id, total, status, created_at FROM orders WHERE user_id=$1 AND id=$2"
-	err = database.DB.QueryRow(query, userID, orderID).Scan(&order.ID, &order.UserID, &order.Total, &order.Status, &order.CreatedAt)
+	query := "SELECT " + services.OrderColumns + " FROM orders WHERE user_id=$1 AND id=$2"
+	err = services.ScanOrder(database.DB.QueryRowContext(ctx, query, userID, orderID), &order)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Order not found", http.StatusNotFound)
 		} else {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
 
+	order.Items, err = services.OrderItems(ctx, database.DB, order.ID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(order)
 }
@@ -169,40 +163,43 @@ func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// make a new struct to extract from request body
-	var updateRequest struct {
-		Status string `json:"status"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
-		http.Error(w, "Invalid Request", http.StatusBadRequest)
+	// the status rule lives on the DTO, so an unknown status never reaches the query
+	var updateRequest models.UpdateOrderStatusRequest
+	if !decodeAndValidate(w, r, &updateRequest) {
 		return
 	}
-	// map > arr, constant-time lookup
-	validStatuses := map[string]bool{
-		"Not Paid":  true,
-		"Paid":      true,
-		"Pending":   true,
-		"Shipped":   true,
-		"Delivered": true,
-		"Cancelled": true,
-	}
 
-	if !validStatuses[updateRequest.Status] {
-		http.Error(w, "Invalid order status", http.StatusBadRequest)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	// cancelling has to release the order's stock, so it goes through the service
+	if updateRequest.Status == "Cancelled" {
+		cancelled, err := services.CancelOrder(ctx, orderID, "cancelled by admin")
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrOrderNotFound):
+				http.Error(w, "Order not found", http.StatusNotFound)
+			case errors.Is(err, services.ErrOrderNotCancellable):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				serverError(w, r, "Database error", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cancelled)
 		return
 	}
 
-	query := "UPDATE orders SET status=$1 WHERE id=$2 RETURNING id, user_id, total, status, created_at"
-	var updatedOrder models.Orders
-	err = database.DB.QueryRow(query, updateRequest.Status, orderID).
-		Scan(&updatedOrder.ID, &updatedOrder.UserID, &updatedOrder.Total, &updatedOrder.Status, &updatedOrder.CreatedAt)
-
+	updatedOrder, err := services.UpdateOrderStatus(ctx, orderID, updateRequest.Status)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
 			http.Error(w, "Order not found", http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		case errors.Is(err, services.ErrOrderCancelled):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
@@ -232,38 +229,34 @@ func CancelOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
 	var order models.Orders
-	query := "SELECT id, user_id, total, status, created_at FROM orders WHERE user_id=$1 AND id=$2"
-	err = database.DB.QueryRow(query, userID, orderID).Scan(&order.ID, &order.UserID, &order.Total, &order.Status, &order.CreatedAt)
+	query := "SELECT " + services.OrderColumns + " FROM orders WHERE user_id=$1 AND id=$2"
+	err = services.ScanOrder(database.DB.QueryRowContext(ctx, query, userID, orderID), &order)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Order not found", http.StatusNotFound)
 		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
-	
-
-	if order.Status == "Shipped" || order.Status == "Delivered" {
-		http.Error(w, fmt.Sprintf("Order cannot be cancelled as it is already %v", order.Status), http.StatusBadRequest)
-		return
-	}
-
-	order.Status = "Cancelled"
-	query = "UPDATE orders SET status=$1 WHERE id=$2 RETURNING id, user_id, total, status, created_at"
-	err = database.DB.QueryRow(query, order.Status, orderID).
-		Scan(&order.ID, &order.UserID, &order.Total, &order.Status, &order.CreatedAt)
 
+	cancelled, err := services.CancelOrder(ctx, order.ID, "cancelled by customer")
 	if err != nil {
-		if err == sql.ErrNoRows {
+		switch {
+		case errors.Is(err, services.ErrOrderNotCancellable):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrOrderNotFound):
 			http.Error(w, "Order not found", http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		default:
+			serverError(w, r, "Database error", err)
 		}
 		return
 	}
-		
+	order = *cancelled
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(order)
@@ -2,11 +2,17 @@ package handlers
 
 import (
 	"e-commerce/database"
+	"e-commerce/logging"
+	"e-commerce/metrics"
 	"e-commerce/middleware"
 	"e-commerce/models"
 	"e-commerce/services"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v78"
 )
 
 func CreatePaymentIntent(w http.ResponseWriter, r *http.Request) {
@@ -18,57 +24,102 @@ func CreatePaymentIntent(w http.ResponseWriter, r *http.Request) {
 
 	userID := user.(int)
 
-	var req struct {
-		OrderID int `json:"order_id"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON Request", http.StatusBadRequest)
+	var req models.PaymentIntentRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
 	var order models.Orders
-	err := database.DB.QueryRow("SELECT id, total FROM orders WHERE id=$1 AND user_id=$2", req.OrderID, userID).Scan(&order.ID, &order.Total)
+	err := database.DB.QueryRowContext(ctx, "SELECT id, total FROM orders WHERE id=$1 AND user_id=$2", req.OrderID, userID).Scan(&order.ID, &order.Total)
 	if err != nil {
 		http.Error(w, "Order not found", http.StatusNotFound)
 		return
 	}
 
-	paymentIntent, err := services.CreatePaymentIntent(order.ID, int64(order.Total), "usd")
+	paymentIntent, err := services.CreatePaymentIntent(r.Context(), order.ID, int64(order.Total), "usd")
 	if err != nil {
-		http.Error(w, "Failed to create a payment intent", http.StatusInternalServerError)
+		serverError(w, r, "Failed to create a payment intent", err)
 		return
 	}
 
+	// the Stripe round trip may have used most of the first budget
+	insertCtx, cancelInsert := database.WithTimeout(r.Context())
+	defer cancelInsert()
+
 	query := "INSERT INTO payments (user_id, order_id, amount, status) VALUES ($1, $2, $3, $4)"
-	_, err = database.DB.Exec(query, userID, order.ID, order.Total, "pending")
+	_, err = database.DB.ExecContext(insertCtx, query, userID, order.ID, order.Total, "pending")
 	if err != nil {
-		http.Error(w, "Failed to store payment", http.StatusInternalServerError)
+		serverError(w, r, "Failed to store payment", err)
 		return
 	}
 
+	metrics.PaymentIntentsCreated.Inc()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"client_secret": paymentIntent.ClientSecret,
 	})
 }
 
+// maxWebhookBytes bounds a Stripe event payload
+const maxWebhookBytes = 64 << 10
+
+// stripePaymentStatuses maps the Stripe events the webhook acts on to the
+// payment status they report; other event types are acknowledged and ignored
+var stripePaymentStatuses = map[stripe.EventType]string{
+	"payment_intent.succeeded":      "completed",
+	"payment_intent.payment_failed": "failed",
+}
+
+// HandleWebhook receives Stripe events. It is not behind the user auth
+// middleware; instead every payload must carry a valid Stripe-Signature, and
+// nothing changes before it has been checked.
 func HandleWebhook(w http.ResponseWriter, r *http.Request) {
-	var payload struct {
-		OrderID int    `json:"order_id"`
-		Status  string `json:"status"`
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		metrics.WebhookEvents.WithLabelValues("unknown", "rejected").Inc()
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	event, err := services.Gateway.ParseWebhook(payload, r.Header.Get("Stripe-Signature"))
+	if err != nil {
+		metrics.WebhookEvents.WithLabelValues("unknown", "rejected").Inc()
+		logging.FromContext(r.Context()).Warn("Rejected payment webhook", "error", err)
+		http.Error(w, "Invalid signature", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	status, ok := stripePaymentStatuses[event.Type]
+	if !ok {
+		metrics.WebhookEvents.WithLabelValues(string(event.Type), "ignored").Inc()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var intent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+		metrics.WebhookEvents.WithLabelValues(status, "rejected").Inc()
+		http.Error(w, "Invalid payment intent", http.StatusBadRequest)
+		return
+	}
+	orderID, err := strconv.Atoi(intent.Metadata["order_id"])
+	if err != nil {
+		// an intent created outside this store, e.g. from the dashboard
+		metrics.WebhookEvents.WithLabelValues(status, "ignored").Inc()
+		logging.FromContext(r.Context()).Warn("Payment webhook without an order", "payment_intent_id", intent.ID)
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	err := services.UpdatePaymentStatus(payload.OrderID, payload.Status)
+	err = services.UpdatePaymentStatus(r.Context(), orderID, status)
 	if err != nil {
-		http.Error(w, "Failed to update payment", http.StatusInternalServerError)
+		metrics.WebhookEvents.WithLabelValues(status, "error").Inc()
+		serverError(w, r, "Failed to update payment", err)
 		return
 	}
+	metrics.WebhookEvents.WithLabelValues(status, "processed").Inc()
 
 	w.WriteHeader(http.StatusOK)
 }
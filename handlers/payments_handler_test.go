@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"e-commerce/config"
+	"e-commerce/database/dbtest"
+	"e-commerce/services"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func stripeEvent(eventType, orderID string) []byte {
+	return []byte(fmt.Sprintf(`{"id": "evt_1", "object": "event", "api_version": %q, "type": %q,
+		"data": {"object": {"id": "pi_1", "object": "payment_intent", "metadata": {"order_id": %q}}}}`,
+		stripe.APIVersion, eventType, orderID))
+}
+
+func webhookRequest(payload []byte, secret string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/webhook", strings.NewReader(string(payload)))
+	if secret != "" {
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: secret})
+		r.Header.Set("Stripe-Signature", signed.Header)
+	}
+	return r
+}
+
+func TestHandleWebhookVerifiesSignatures(t *testing.T) {
+	previous := services.Gateway
+	services.Gateway = services.NewStripeGateway(config.StripeConfig{WebhookSecret: testWebhookSecret})
+	t.Cleanup(func() { services.Gateway = previous })
+
+	tests := []struct {
+		name    string
+		secret  string
+		event   []byte
+		status  int
+		paidFor bool
+	}{
+		{"unsigned", "", stripeEvent("payment_intent.succeeded", "7"), http.StatusBadRequest, false},
+		{"signed with another secret", "whsec_other", stripeEvent("payment_intent.succeeded", "7"), http.StatusBadRequest, false},
+		{"forged body", "", []byte(`{"order_id": 7, "status": "completed"}`), http.StatusBadRequest, false},
+		{"payment succeeded", testWebhookSecret, stripeEvent("payment_intent.succeeded", "7"), http.StatusOK, true},
+		{"payment failed", testWebhookSecret, stripeEvent("payment_intent.payment_failed", "7"), http.StatusOK, false},
+		{"other event", testWebhookSecret, stripeEvent("charge.refunded", "7"), http.StatusOK, false},
+		{"intent without an order", testWebhookSecret, stripeEvent("payment_intent.succeeded", ""), http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				return dbtest.Result{RowsAffected: 1}
+			})
+			w := httptest.NewRecorder()
+			HandleWebhook(w, webhookRequest(tt.event, tt.secret))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, body %s, want %d", w.Code, w.Body, tt.status)
+			}
+			paid := db.Ran("UPDATE orders SET status='Paid'")
+			if tt.paidFor != (len(paid) == 1) {
+				t.Errorf("order marked paid %d times, want paid = %v", len(paid), tt.paidFor)
+			}
+			if tt.paidFor && paid[0].Args[0] != int64(7) {
+				t.Errorf("paid order %v, want 7", paid[0].Args[0])
+			}
+			if tt.status != http.StatusOK && len(db.Calls()) != 0 {
+				t.Errorf("a rejected webhook ran %v", db.Calls())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// priceError maps pricing service errors to responses
+func priceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrPriceNotFound):
+		http.Error(w, "Scheduled price not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrPriceOverlap):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidPriceWindow), errors.Is(err, services.ErrSaleAboveCompareAt):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		serverError(w, r, "Database error", err)
+	}
+}
+
+// priceVars reads the {id} and, when present, {price_id} route variables,
+// writing the error response itself when either is invalid
+func priceVars(w http.ResponseWriter, r *http.Request) (productID, priceID int, ok bool) {
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	if s, exists := vars["price_id"]; exists {
+		if priceID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid price ID", http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return productID, priceID, true
+}
+
+// ADMIN ONLY: a product's price schedule, past windows included
+func ListScheduledPrices(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := priceVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	prices, err := services.ScheduledPrices(ctx, productID)
+	if err != nil {
+		priceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prices)
+}
+
+// ADMIN ONLY: schedule a sale price from starts_at until ends_at, or with no
+// end. Windows of one product may not overlap.
+func CreateScheduledPrice(w http.ResponseWriter, r *http.Request) {
+	productID, _, ok := priceVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ScheduledPriceRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	price := models.ScheduledPrice{ProductID: productID, SalePrice: req.SalePrice, CompareAtPrice: req.CompareAtPrice,
+		StartsAt: *req.StartsAt, EndsAt: req.EndsAt}
+	if err := services.CreateScheduledPrice(ctx, &price); err != nil {
+		priceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(price)
+}
+
+// ADMIN ONLY: replace one window of a product's price schedule
+func UpdateScheduledPrice(w http.ResponseWriter, r *http.Request) {
+	productID, priceID, ok := priceVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ScheduledPriceRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	price := models.ScheduledPrice{ID: priceID, ProductID: productID, SalePrice: req.SalePrice, CompareAtPrice: req.CompareAtPrice,
+		StartsAt: *req.StartsAt, EndsAt: req.EndsAt}
+	if err := services.UpdateScheduledPrice(ctx, &price); err != nil {
+		priceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(price)
+}
+
+// ADMIN ONLY: remove one window of a product's price schedule
+func DeleteScheduledPrice(w http.ResponseWriter, r *http.Request) {
+	productID, priceID, ok := priceVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.DeleteScheduledPrice(ctx, productID, priceID); err != nil {
+		priceError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,14 +4,22 @@ import (
 	"e-commerce/database"
 	"e-commerce/middleware"
 	"e-commerce/models"
+	"e-commerce/services"
+	"e-commerce/utils"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 func AddProduct(w http.ResponseWriter, r *http.Request) { // ADMIN ONLY function
-	_, ok := r.Context().Value(middleware.UserIDKey).(int)
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(int)
 	isAdmin, adminOk := r.Context().Value(middleware.IsAdminKey).(bool)
 
 	if !ok || !adminOk || !isAdmin {
@@ -19,16 +27,26 @@ func AddProduct(w http.ResponseWriter, r *http.Request) { // ADMIN ONLY function
 		return
 	}
 
-	var product models.Products
-	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req models.ProductRequest
+	if !decodeAndValidate(w, r, &req) {
 		return
 	}
 
-	query := "INSERT INTO products (name, description, price, stock) VALUES($1, $2, $3, $4) RETURNING id"
-	err := database.DB.QueryRow(query, product.Name, product.Description, product.Price, product.Stock).Scan(&product.ID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	product := models.Products{SKU: req.SKU, Name: req.Name, Description: req.Description, Price: req.Price, Stock: req.Stock, Category: req.Category,
+		TaxClass: req.TaxClass, Weight: req.Weight, LowStockThreshold: req.LowStockThreshold}
+	if product.TaxClass == "" {
+		product.TaxClass = services.DefaultTaxClass
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.CreateProduct(ctx, &product, adminID); err != nil {
+		if errors.Is(err, services.ErrDuplicateSKU) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
 		return
 	}
 
@@ -43,28 +61,21 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := "SELECT id, name, description, price, stock FROM products"
-	rows, err := database.DB.Query(query)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	products, err := services.ListProducts(ctx, false)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		serverError(w, r, "Database error", err)
 		return
 	}
-	defer rows.Close()
-
-	var products []models.Products
-	for rows.Next() {
-		var product models.Products
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock); err != nil {
-			http.Error(w, "Error scanning products", http.StatusInternalServerError)
-			return
-		}
-		products = append(products, product)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
 }
 
+// GetProductByID also resolves archived products, so links from past orders
+// keep working; archived_at tells the client it can no longer be bought
 func GetProductByID(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey)
 	if userID == nil {
@@ -84,14 +95,24 @@ func GetProductByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var product models.Products
-	query := "SELECT id, name, description, price, stock FROM products WHERE id=$1"
-	err = database.DB.QueryRow(query, productID).Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.Stock)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	product, err := services.GetProduct(ctx, database.Reader(), productID)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		if errors.Is(err, services.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
 		return
 	}
 
+	w.Header().Set("ETag", productETag(product))
+	if h := r.Header.Get("If-None-Match"); h != "" && etagMatches(h, productETag(product), true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(product)
 }
@@ -117,23 +138,67 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var product models.Products
-	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req models.ProductUpdateRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	if req.Stock != nil {
+		validationFailed(w, utils.ValidationErrors{"stock": {"cannot be updated here; record a stock movement instead"}})
 		return
 	}
 
-	query := "UPDATE products SET name=$1, description=$2, price=$3, stock=$4 WHERE id=$5"
-	_, err = database.DB.Exec(query, product.Name, product.Description, product.Price, product.Stock, productID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	product := models.Products{ID: productID, SKU: req.SKU, Name: req.Name, Description: req.Description, Price: req.Price, Category: req.Category,
+		TaxClass: req.TaxClass, Weight: req.Weight, LowStockThreshold: req.LowStockThreshold}
+	if product.TaxClass == "" {
+		product.TaxClass = services.DefaultTaxClass
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	// with If-Match the update only applies to the version the client has
+	var version *int
+	if h := r.Header.Get("If-Match"); h != "" {
+		current, err := services.GetProduct(ctx, database.DB, productID)
+		if err != nil {
+			if errors.Is(err, services.ErrProductNotFound) {
+				http.Error(w, "Product not found", http.StatusNotFound)
+			} else {
+				serverError(w, r, "Database error", err)
+			}
+			return
+		}
+		if !etagMatches(h, productETag(current), false) {
+			w.Header().Set("ETag", productETag(current))
+			http.Error(w, services.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		version = &current.Version
+	}
+
+	if err := services.UpdateProduct(ctx, &product, version, !req.SKUSent); err != nil {
+		switch {
+		case errors.Is(err, services.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, services.ErrDuplicateSKU):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrPriceBelowSale):
+			validationFailed(w, utils.ValidationErrors{"price": {err.Error()}})
+		default:
+			serverError(w, r, "Database error", err)
+		}
 		return
 	}
 
+	w.Header().Set("ETag", productETag(&product))
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Product updated successfully"))
 }
 
+// DeleteProduct archives the product; it stays in the database for order history
+// and can be restored
 func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	_, ok := r.Context().Value(middleware.UserIDKey).(int)              // User ID (not needed here)
 	isAdmin, adminOk := r.Context().Value(middleware.IsAdminKey).(bool) // Extract admin flag
@@ -155,12 +220,188 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := "DELETE FROM products WHERE id=$1"
-	_, err = database.DB.Exec(query, productID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.ArchiveProduct(ctx, productID); err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// ADMIN ONLY: archived products, most recently archived first
+func ListArchivedProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	products, err := services.ListProducts(ctx, true)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// ADMIN ONLY: put an archived product back on the storefront
+func RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	product, err := services.RestoreProduct(ctx, productID)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// patchableFields are the product fields PATCH may change; stock goes through
+// the inventory ledger instead
+var patchableFields = []string{"sku", "name", "description", "price", "category", "tax_class", "weight", "low_stock_threshold"}
+
+// ADMIN ONLY: PatchProduct applies a JSON Merge Patch (RFC 7396) to a product:
+// fields in the body replace the current values, null clears an optional field
+// and omitted fields are kept. The result is validated like a PUT. If-Match is
+// honoured, and the write itself is conditional on the version that was
+// patched, so a concurrent update fails with 412 instead of being overwritten.
+func PatchProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil || fields == nil {
+		http.Error(w, "Patch must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	for field := range fields {
+		if !slices.Contains(patchableFields, field) {
+			http.Error(w, fmt.Sprintf("Field %q cannot be patched", field), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	current, err := services.GetProduct(ctx, database.DB, productID)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+	if h := r.Header.Get("If-Match"); h != "" && !etagMatches(h, productETag(current), false) {
+		w.Header().Set("ETag", productETag(current))
+		http.Error(w, services.ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	doc, err := json.Marshal(models.ProductRequest{SKU: current.SKU, Name: current.Name, Description: current.Description, Price: current.Price,
+		Category: current.Category, TaxClass: current.TaxClass, Weight: current.Weight, LowStockThreshold: current.LowStockThreshold})
+	if err != nil {
+		serverError(w, r, "Error encoding product", err)
+		return
+	}
+	merged, err := utils.MergePatch(doc, patch)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var req models.ProductRequest
+	if err := json.Unmarshal(merged, &req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validate(w, &req) {
+		return
+	}
+
+	product := models.Products{ID: productID, SKU: req.SKU, Name: req.Name, Description: req.Description, Price: req.Price, Category: req.Category,
+		TaxClass: req.TaxClass, Weight: req.Weight, LowStockThreshold: req.LowStockThreshold}
+	if product.TaxClass == "" {
+		product.TaxClass = services.DefaultTaxClass
+	}
+
+	if err := services.UpdateProduct(ctx, &product, &current.Version, false); err != nil {
+		switch {
+		case errors.Is(err, services.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		case errors.Is(err, services.ErrDuplicateSKU):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrPriceBelowSale):
+			validationFailed(w, utils.ValidationErrors{"price": {err.Error()}})
+		default:
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", productETag(&product))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// productETag is the strong ETag of a product's representation: its version,
+// and the scheduled price in effect, since a sale starting or ending changes
+// the effective price without an update
+func productETag(p *models.Products) string {
+	if p.SaleID != nil {
+		return fmt.Sprintf(`"%d-%d"`, p.Version, *p.SaleID)
+	}
+	return `"` + strconv.Itoa(p.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag;
+// "*" matches any. If-Match requires strong comparison, so weak validators only
+// count when weak is set.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
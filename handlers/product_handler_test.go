@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"e-commerce/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateProductRejectsStock(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	w := httptest.NewRecorder()
+	body := `{"name": "Lamp", "price": 20, "stock": 50}`
+	UpdateProduct(w, request(http.MethodPut, "/api/admin/products/4", body, 1, true, map[string]string{"id": "4"}))
+
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"stock"`) {
+		t.Fatalf("status = %d, body %s, want 422 naming stock", w.Code, w.Body)
+	}
+	if len(db.Calls()) != 0 {
+		t.Errorf("ran %d statements for a rejected update", len(db.Calls()))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"3"`, false, true},
+		{`"4"`, false, false},
+		{`*`, false, true},
+		{`*`, true, true},
+		{`W/"3"`, true, true},
+		{`W/"3"`, false, false},
+		{`"1", "2", "3"`, false, true},
+		{`"1",W/"3"`, true, true},
+		{`"1","2"`, true, false},
+		{`"3-7"`, false, false},
+		{`3`, false, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"3"`, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%s, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateProductKeepsSKUUnlessSent(t *testing.T) {
+	tests := []struct {
+		body    string
+		keepSKU bool
+	}{
+		{`{"name": "Lamp", "price": 20}`, true},
+		{`{"name": "Lamp", "price": 20, "sku": null}`, false},
+		{`{"name": "Lamp", "price": 20, "sku": "L-2"}`, false},
+	}
+	for _, tt := range tests {
+		db := dbtest.New(t, nil)
+		UpdateProduct(httptest.NewRecorder(), request(http.MethodPut, "/api/admin/products/4", tt.body, 1, true, map[string]string{"id": "4"}))
+
+		calls := db.Ran("UPDATE products SET sku")
+		if len(calls) != 1 {
+			t.Fatalf("%s: ran %d updates, want 1", tt.body, len(calls))
+		}
+		if keep := calls[0].Args[10]; keep != tt.keepSKU {
+			t.Errorf("%s: keepSKU = %v, want %v", tt.body, keep, tt.keepSKU)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/logging"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImportBytes bounds an uploaded import file
+const maxImportBytes = 32 << 20
+
+// exportFlushRows is how many products an export writes between flushes
+const exportFlushRows = 100
+
+// importFormat takes the format from ?format=, falling back to the Content-Type
+func importFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format, format == services.FormatCSV || format == services.FormatNDJSON
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return services.FormatCSV, true
+	case "application/x-ndjson", "application/ndjson":
+		return services.FormatNDJSON, true
+	}
+	return "", false
+}
+
+// ADMIN ONLY: ImportProducts upserts products by SKU from a CSV or NDJSON body.
+// With ?dry_run=true rows are validated and counted but nothing is written.
+// Small files are imported before responding, with the report; larger ones
+// return 202 and the report to poll while a background job runs them.
+func ImportProducts(w http.ResponseWriter, r *http.Request) {
+	adminID, _ := r.Context().Value(middleware.UserIDKey).(int)
+
+	format, ok := importFormat(r)
+	if !ok {
+		http.Error(w, "Send text/csv or application/x-ndjson, or set ?format=csv|ndjson", http.StatusUnsupportedMediaType)
+		return
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid dry_run", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import file is larger than %d MB", maxImportBytes>>20), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		}
+		return
+	}
+
+	// each row is bounded by its own query timeout
+	imp, err := services.StartImport(r.Context(), format, data, dryRun, adminID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImport) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			serverError(w, r, "Import failed", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if imp.Status != models.ImportCompleted {
+		w.Header().Set("Location", fmt.Sprintf("/api/admin/products/imports/%d", imp.ID))
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(imp)
+}
+
+// ADMIN ONLY: the report of an import, including the progress of a background one
+func GetProductImport(w http.ResponseWriter, r *http.Request) {
+	importID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid import ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	imp, err := services.GetImport(ctx, importID)
+	if err != nil {
+		if errors.Is(err, services.ErrImportNotFound) {
+			http.Error(w, "Import not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imp)
+}
+
+// ADMIN ONLY: ExportProducts streams the catalog as ?format=csv (the default) or
+// ndjson, with the columns an import accepts, so an export can be edited and
+// imported back. Archived products are included with ?archived=true.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.FormatCSV
+	}
+	if format != services.FormatCSV && format != services.FormatNDJSON {
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	archived := false
+	if v := r.URL.Query().Get("archived"); v != "" {
+		var err error
+		if archived, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid archived", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// a large catalog can take longer to send than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	var write func(models.Products) error
+	flush := func() error { return nil }
+	if format == services.FormatCSV {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(services.ImportColumns); err != nil {
+			serverError(w, r, "Export failed", err)
+			return
+		}
+		write = func(p models.Products) error { return cw.Write(exportRecord(p)) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(p models.Products) error { return enc.Encode(exportRow(p)) }
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format))
+
+	written := 0
+	err := services.ExportProducts(r.Context(), archived, func(p models.Products) error {
+		if err := write(p); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushRows == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// once rows have been sent the status can no longer change, so the
+		// truncated body is all the client gets
+		if written == 0 {
+			serverError(w, r, "Export failed", err)
+		} else {
+			logging.FromContext(r.Context()).Error("Export failed", "error", err, "rows", written)
+		}
+	}
+}
+
+// exportRow is a product as an NDJSON import row
+func exportRow(p models.Products) models.ProductRequest {
+	return models.ProductRequest{SKU: p.SKU, Name: p.Name, Description: p.Description, Price: p.Price, Stock: p.Stock,
+		Category: p.Category, TaxClass: p.TaxClass, Weight: p.Weight, LowStockThreshold: p.LowStockThreshold}
+}
+
+// exportRecord is a product as a CSV row in ImportColumns order
+func exportRecord(p models.Products) []string {
+	var sku, threshold string
+	if p.SKU != nil {
+		sku = *p.SKU
+	}
+	if p.LowStockThreshold != nil {
+		threshold = strconv.Itoa(*p.LowStockThreshold)
+	}
+	return []string{sku, p.Name, p.Description, strconv.FormatFloat(p.Price, 'f', -1, 64), strconv.Itoa(p.Stock), p.Category,
+		p.TaxClass, strconv.FormatFloat(p.Weight, 'f', -1, 64), threshold}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+)
+
+// CreateReview submits a review for moderation; the caller needs a delivered
+// order containing the product
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReviewRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	review := models.Review{ProductID: productID, UserID: userID, Rating: req.Rating, Title: req.Title, Body: req.Body}
+	if err := services.CreateReview(ctx, &review); err != nil {
+		switch {
+		case errors.Is(err, services.ErrProductNotFound):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrNotVerifiedBuyer):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, services.ErrAlreadyReviewed):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// ListProductReviews returns a product's approved reviews, newest first;
+// ?limit= caps the number returned
+func ListProductReviews(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultReviewLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxReviewLimit {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	reviews, err := services.ProductReviews(ctx, productID, limit)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ADMIN ONLY: the moderation queue, by ?status= (pending, approved or rejected;
+// defaults to pending)
+func ListReviews(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ReviewPending
+	case models.ReviewPending, models.ReviewApproved, models.ReviewRejected:
+	default:
+		http.Error(w, "status must be one of pending, approved, rejected", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	reviews, err := services.ReviewsByStatus(ctx, status, maxReviewLimit)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// ADMIN ONLY: approve or reject a review
+func ModerateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReviewStatusRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	review, err := services.SetReviewStatus(ctx, reviewID, req.Status)
+	if err != nil {
+		if errors.Is(err, services.ErrReviewNotFound) {
+			http.Error(w, "Review not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// ADMIN ONLY: delete a review
+func DeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.DeleteReview(ctx, reviewID); err != nil {
+		if errors.Is(err, services.ErrReviewNotFound) {
+			http.Error(w, "Review not found", http.StatusNotFound)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModerateReviewApproves(t *testing.T) {
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "SELECT status FROM reviews"):
+			return dbtest.Row(models.ReviewPending)
+		case strings.Contains(query, "FROM reviews r JOIN users u"):
+			return dbtest.Row(int64(3), int64(11), int64(7), "alice", int64(4), "Great", "Works well", models.ReviewApproved, time.Now())
+		}
+		return dbtest.Result{RowsAffected: 1}
+	})
+
+	w := httptest.NewRecorder()
+	ModerateReview(w, request(http.MethodPut, "/api/reviews/3", `{"status": "approved"}`, 1, true, map[string]string{"id": "3"}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var review models.Review
+	if err := json.NewDecoder(w.Body).Decode(&review); err != nil {
+		t.Fatal(err)
+	}
+	if review.Status != models.ReviewApproved {
+		t.Errorf("review status = %q, want approved", review.Status)
+	}
+	updates := db.Ran("UPDATE reviews SET status")
+	if len(updates) != 1 || updates[0].Args[0] != models.ReviewApproved {
+		t.Fatalf("status updates = %v", updates)
+	}
+	rating := db.Ran("UPDATE products SET rating_sum")
+	if len(rating) != 1 || rating[0].Args[0] != int64(4) || rating[0].Args[1] != int64(1) {
+		t.Errorf("rating updates = %v, want one adding 4 to the sum", rating)
+	}
+}
+
+func TestModerateReviewRejectsUnknownStatus(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	w := httptest.NewRecorder()
+	ModerateReview(w, request(http.MethodPut, "/api/reviews/3", `{"status": "hidden"}`, 1, true, map[string]string{"id": "3"}))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if len(db.Calls()) != 0 {
+		t.Errorf("ran %d statements for a rejected request", len(db.Calls()))
+	}
+}
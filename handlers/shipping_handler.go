@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ShippingOptions lists the methods available for the user's current cart, priced
+// after any coupon discount and waived by a free-shipping coupon
+func ShippingOptions(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	lines, err := services.CartLines(ctx, database.DB, userID)
+	if err != nil {
+		serverError(w, r, "Failed to fetch cart items", err)
+		return
+	}
+	if len(lines) == 0 {
+		http.Error(w, "Cart is empty", http.StatusBadRequest)
+		return
+	}
+
+	coupon, err := services.AppliedCoupon(ctx, database.DB, userID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	// an ineligible coupon is ignored here; checkout reports why it was rejected
+	var discount float64
+	freeShipping := false
+	if coupon != nil && services.CheckCouponEligibility(ctx, database.DB, coupon, userID, lines) == nil {
+		discount = services.ApplyCouponDiscount(coupon, lines)
+		freeShipping = coupon.Type == models.CouponFreeShipping
+	}
+
+	subtotal := services.CartSubtotal(lines) - discount
+	options, err := services.ShippingOptions(ctx, database.DB, services.CartWeight(lines), subtotal, freeShipping)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// ADMIN ONLY: create a shipping method with its rate table
+func CreateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	var req models.ShippingMethodRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	method := models.ShippingMethod{Code: strings.ToLower(req.Code), Name: req.Name, Carrier: req.Carrier, Active: true}
+	for _, rate := range req.Rates {
+		method.Rates = append(method.Rates, models.ShippingRate{
+			MinWeight:   rate.MinWeight,
+			MaxWeight:   rate.MaxWeight,
+			MinSubtotal: rate.MinSubtotal,
+			MaxSubtotal: rate.MaxSubtotal,
+			Price:       rate.Price,
+		})
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.CreateShippingMethod(ctx, &method); err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			http.Error(w, "Shipping method code already exists", http.StatusConflict)
+		} else {
+			serverError(w, r, "Database error", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(method)
+}
+
+// ADMIN ONLY: list shipping methods with their rate tables
+func ListShippingMethods(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	methods, err := services.ListShippingMethods(ctx)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
+
+// ADMIN ONLY: record a shipment with its tracking number. Shipping part of an
+// order moves it to "Partially Shipped"; shipping the rest moves it to "Shipped".
+func CreateShipment(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ShipmentRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	shipment, status, err := services.CreateShipment(ctx, orderID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrOrderNotShippable), errors.Is(err, services.ErrNothingToShip):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrInvalidShipment):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			serverError(w, r, "Failed to create shipment", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Shipment    *models.Shipment `json:"shipment"`
+		OrderStatus string           `json:"order_status"`
+	}{Shipment: shipment, OrderStatus: status})
+}
+
+// ListShipments returns the tracking details for one of the user's orders
+func ListShipments(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	var owner int
+	err = database.DB.QueryRowContext(ctx, "SELECT user_id FROM orders WHERE id=$1", orderID).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	shipments, err := services.OrderShipments(ctx, database.DB, orderID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shipments)
+}
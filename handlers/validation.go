@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"e-commerce/utils"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// decodeAndValidate decodes the JSON body into dst and runs its validation rules.
+// An empty body is treated as {} so missing fields are reported by validation.
+// On failure it writes the response itself and returns false.
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return validate(w, dst)
+}
+
+// validate runs dst's validation rules, writing a 422 with every failure and
+// returning false when any fail
+func validate(w http.ResponseWriter, dst interface{}) bool {
+	if errs := utils.Validate(dst); errs != nil {
+		validationFailed(w, errs)
+		return false
+	}
+	return true
+}
+
+// validationFailed writes a 422 listing errs, for checks the validation rules cannot express
+func validationFailed(w http.ResponseWriter, errs utils.ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Errors utils.ValidationErrors `json:"errors"`
+	}{Errors: errs})
+}
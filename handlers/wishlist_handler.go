@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"e-commerce/database"
+	"e-commerce/middleware"
+	"e-commerce/models"
+	"e-commerce/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// wishlistError maps wishlist service errors to responses
+func wishlistError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrWishlistNotFound):
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrWishlistItemNotFound), errors.Is(err, services.ErrNotInCart):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	default:
+		serverError(w, r, "Database error", err)
+	}
+}
+
+// wishlistVars reads the user and the {id} route variable, writing the error
+// response itself when either is missing
+func wishlistVars(w http.ResponseWriter, r *http.Request) (userID, wishlistID int, ok bool) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid wishlist ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return user.(int), wishlistID, true
+}
+
+func ListWishlists(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	lists, err := services.ListWishlists(ctx, userID)
+	if err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+func CreateWishlist(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	var req models.WishlistRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list := models.Wishlist{UserID: userID, Name: req.Name, Items: []models.WishlistItem{}}
+	if err := services.CreateWishlist(ctx, &list); err != nil {
+		serverError(w, r, "Database error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+func GetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := services.GetWishlist(ctx, userID, wishlistID)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func RenameWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.WishlistRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := services.RenameWishlist(ctx, userID, wishlistID, req.Name)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.DeleteWishlist(ctx, userID, wishlistID); err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.WishlistItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := services.AddWishlistItem(ctx, userID, wishlistID, req.ProductID)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func RemoveWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(mux.Vars(r)["product_id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.RemoveWishlistItem(ctx, userID, wishlistID, productID); err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveWishlistItemToCart moves a product from a wishlist into the cart
+func MoveWishlistItemToCart(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(mux.Vars(r)["product_id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MoveToCartRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	quantity := 1
+	if req.Quantity != nil {
+		quantity = *req.Quantity
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	item, err := services.MoveToCart(ctx, userID, wishlistID, productID, quantity)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// SaveForLater moves a product from the cart to one of the user's wishlists
+func SaveForLater(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserIDKey)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := user.(int)
+
+	productID, err := strconv.Atoi(mux.Vars(r)["product_id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MoveToWishlistRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := services.MoveToWishlist(ctx, userID, productID, req.WishlistID)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ShareWishlist returns the read-only link for a list, creating it if needed
+func ShareWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	token, err := services.ShareWishlist(ctx, userID, wishlistID)
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Token string `json:"token"`
+		Path  string `json:"path"`
+	}{Token: token, Path: "/shared/wishlists/" + token})
+}
+
+func UnshareWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, wishlistID, ok := wishlistVars(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	if err := services.UnshareWishlist(ctx, userID, wishlistID); err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ViewSharedWishlist is public: anyone with the link can read the list
+func ViewSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := database.WithTimeout(r.Context())
+	defer cancel()
+
+	list, err := services.SharedWishlist(ctx, mux.Vars(r)["token"])
+	if err != nil {
+		wishlistError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func moveToCart(t *testing.T, body string) (*httptest.ResponseRecorder, *dbtest.DB) {
+	t.Helper()
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "INSERT INTO cart") {
+			return dbtest.Row(int64(21), time.Now())
+		}
+		return dbtest.Result{RowsAffected: 1}
+	})
+
+	w := httptest.NewRecorder()
+	vars := map[string]string{"id": "4", "product_id": "11"}
+	MoveWishlistItemToCart(w, request(http.MethodPost, "/api/wishlists/4/items/11/move-to-cart", body, 7, false, vars))
+	return w, db
+}
+
+func TestMoveWishlistItemToCartDefaultsQuantity(t *testing.T) {
+	for _, body := range []string{`{}`, `{"quantity": null}`} {
+		w, db := moveToCart(t, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200: %s", body, w.Code, w.Body)
+		}
+		inserts := db.Ran("INSERT INTO cart")
+		if len(inserts) != 1 || inserts[0].Args[2] != int64(1) {
+			t.Errorf("%s: cart inserts = %v, want one of quantity 1", body, inserts)
+		}
+	}
+}
+
+func TestMoveWishlistItemToCartQuantity(t *testing.T) {
+	w, db := moveToCart(t, `{"quantity": 3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	inserts := db.Ran("INSERT INTO cart")
+	if len(inserts) != 1 || inserts[0].Args[2] != int64(3) {
+		t.Errorf("cart inserts = %v, want one of quantity 3", inserts)
+	}
+
+	if w, _ := moveToCart(t, `{"quantity": 0}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("quantity 0: status = %d, want 422", w.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Handler runs one job. Returning an error schedules a retry with backoff until
+// the job runs out of attempts, after which it is dead-lettered.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Register installs the handler for a job kind. It is meant to be called during
+// startup, before the worker pool starts.
+func Register(kind string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = h
+}
+
+func handlerFor(kind string) (Handler, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	h, ok := handlers[kind]
+	return h, ok
+}
+
+// Job is a row of the jobs table
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error,omitempty"`
+	UniqueKey   *string         `json:"unique_key,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// NewJob describes a job to enqueue. A zero RunAt runs it as soon as a worker is
+// free and a zero MaxAttempts uses the configured default. While a job with the
+// same UniqueKey is pending or running, enqueueing another is a no-op.
+type NewJob struct {
+	Kind        string
+	Payload     interface{}
+	RunAt       time.Time
+	MaxAttempts int
+	UniqueKey   string
+}
+
+var defaultMaxAttempts = 5
+
+// Enqueue stores a job. Passing the caller's transaction as q makes the job part
+// of it, so the job only becomes visible if the surrounding change commits. It
+// returns 0 when an identical unique job is already queued.
+func Enqueue(ctx context.Context, q database.Querier, job NewJob) (int64, error) {
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s payload: %w", job.Kind, err)
+	}
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	var runAt interface{}
+	if !job.RunAt.IsZero() {
+		runAt = job.RunAt.UTC()
+	}
+	var uniqueKey interface{}
+	if job.UniqueKey != "" {
+		uniqueKey = job.UniqueKey
+	}
+
+	query := `INSERT INTO jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()), $5)
+		ON CONFLICT (unique_key) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING id`
+	var id int64
+	err = q.QueryRowContext(ctx, query, job.Kind, payload, maxAttempts, runAt, uniqueKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+const jobColumns = "id, kind, payload, status, attempts, max_attempts, run_at, last_error, unique_key, created_at, updated_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }, j *Job) error {
+	return row.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LastError, &j.UniqueKey, &j.CreatedAt, &j.UpdatedAt)
+}
+
+// List returns jobs in the given status, most recently updated first
+func List(ctx context.Context, status string, limit int) ([]Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs WHERE status=$1 ORDER BY updated_at DESC LIMIT $2"
+	rows, err := database.DB.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Job{}
+	for rows.Next() {
+		var j Job
+		if err := scanJob(rows, &j); err != nil {
+			return nil, err
+		}
+		list = append(list, j)
+	}
+	return list, rows.Err()
+}
+
+// Retry puts a dead job back in the queue with a fresh set of attempts
+func Retry(ctx context.Context, id int64) (*Job, error) {
+	query := `UPDATE jobs SET status='pending', attempts=0, run_at=NOW(), updated_at=NOW()
+		WHERE id=$1 AND status='dead' RETURNING ` + jobColumns
+	var j Job
+	err := scanJob(database.DB.QueryRowContext(ctx, query, id), &j)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Prune deletes finished jobs older than retention; dead jobs are kept for inspection
+func Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	res, err := database.DB.ExecContext(ctx,
+		"DELETE FROM jobs WHERE status='done' AND updated_at < NOW() - make_interval(secs => $1)", retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
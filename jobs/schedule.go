@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"e-commerce/database"
+	"log/slog"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+type schedule struct {
+	spec    string
+	kind    string
+	payload interface{}
+}
+
+var (
+	schedulesMu sync.Mutex
+	schedules   []schedule
+)
+
+// Schedule enqueues a job of the given kind on a cron spec, either five standard
+// fields or a descriptor such as "@hourly" or "@every 5m". Every process runs the
+// scheduler; the job's unique key keeps at most one instance queued at a time,
+// so a slow run is never overlapped by the next tick.
+func Schedule(spec, kind string, payload interface{}) error {
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return err
+	}
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+	schedules = append(schedules, schedule{spec: spec, kind: kind, payload: payload})
+	return nil
+}
+
+func startScheduler(ctx context.Context) (stop func()) {
+	c := cron.New()
+
+	schedulesMu.Lock()
+	for _, s := range schedules {
+		s := s
+		c.AddFunc(s.spec, func() {
+			dbCtx, cancel := database.WithTimeout(ctx)
+			defer cancel()
+			_, err := Enqueue(dbCtx, database.DB, NewJob{Kind: s.kind, Payload: s.payload, UniqueKey: "cron:" + s.kind})
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Enqueueing scheduled job failed", "job_kind", s.kind, "error", err)
+			}
+		})
+	}
+	schedulesMu.Unlock()
+
+	c.Start()
+	return func() {
+		<-c.Stop().Done()
+	}
+}
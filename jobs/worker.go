@@ -0,0 +1,280 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/config"
+	"e-commerce/database"
+	"e-commerce/logging"
+	"e-commerce/metrics"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Configure applies the queue settings that also matter to processes that only
+// enqueue, such as an API server running without workers
+func Configure(cfg config.JobsConfig) {
+	defaultMaxAttempts = cfg.MaxAttempts
+}
+
+// Start runs cfg.Workers workers that claim due jobs, plus the cron scheduler and
+// a sweeper that requeues jobs whose worker died mid-run. The returned function
+// stops everything and waits for jobs in progress to finish, so it must be
+// called before the database is closed.
+func Start(cfg config.JobsConfig) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, cfg)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sweep(ctx, cfg)
+	}()
+
+	stopScheduler := startScheduler(ctx)
+	slog.Info("Job workers started", "workers", cfg.Workers)
+
+	return func() {
+		cancel()
+		stopScheduler()
+		wg.Wait()
+	}
+}
+
+// work claims and runs jobs until ctx is cancelled, sleeping for the poll
+// interval whenever the queue has nothing due
+func work(ctx context.Context, cfg config.JobsConfig) {
+	for {
+		job, err := claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Claiming job failed", "error", err)
+		}
+		if job != nil {
+			run(ctx, cfg, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.PollInterval):
+		}
+	}
+}
+
+// claim locks the oldest due job. SKIP LOCKED lets any number of workers, in
+// any number of processes, poll the same table without handing out a job twice.
+func claim(ctx context.Context) (*Job, error) {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE jobs SET status='running', attempts=attempts+1, locked_at=NOW(), updated_at=NOW()
+		WHERE id = (
+			SELECT id FROM jobs WHERE status='pending' AND run_at <= NOW()
+			ORDER BY run_at, id FOR UPDATE SKIP LOCKED LIMIT 1
+		)
+		RETURNING ` + jobColumns
+	var j Job
+	err := scanJob(database.DB.QueryRowContext(dbCtx, query), &j)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func run(ctx context.Context, cfg config.JobsConfig, job *Job) {
+	logger := slog.Default().With("job_id", job.ID, "job_kind", job.Kind, "attempt", job.Attempts)
+	jobCtx, cancel := context.WithTimeout(context.WithValue(logging.WithLogger(ctx, logger), jobKey{}, job), cfg.Timeout)
+	defer cancel()
+
+	handler, ok := handlerFor(job.Kind)
+	if !ok {
+		finish(ctx, logger, job, fmt.Errorf("no handler registered for %q", job.Kind), true, cfg)
+		return
+	}
+
+	stopHeartbeat := heartbeat(ctx, logger, job, max(cfg.Timeout/2, time.Millisecond))
+	start := time.Now()
+	err := runHandler(jobCtx, handler, job)
+	stopHeartbeat()
+	metrics.JobDuration.WithLabelValues(job.Kind).Observe(time.Since(start).Seconds())
+	finish(ctx, logger, job, err, false, cfg)
+}
+
+type jobKey struct{}
+
+// LastAttempt reports whether the job running with ctx is on its final attempt,
+// so a handler can record that it gave up before the job is dead-lettered
+func LastAttempt(ctx context.Context) bool {
+	job, ok := ctx.Value(jobKey{}).(*Job)
+	return ok && job.Attempts >= job.MaxAttempts
+}
+
+// runHandler turns a panicking handler into a failed attempt instead of a dead worker
+func runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+// heartbeat refreshes the job's lock every interval until stopped, so the
+// sweeper only requeues jobs whose worker is gone, never one still running
+// past its timeout
+func heartbeat(ctx context.Context, logger *slog.Logger, job *Job, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				dbCtx, cancel := database.WithTimeout(context.WithoutCancel(ctx))
+				_, err := database.DB.ExecContext(dbCtx,
+					"UPDATE jobs SET locked_at=NOW() WHERE id=$1 AND status='running' AND attempts=$2", job.ID, job.Attempts)
+				cancel()
+				if err != nil {
+					logger.Error("Refreshing job lock failed", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// finish records the outcome of an attempt. A failure is retried after an
+// exponential backoff with jitter until the job runs out of attempts. Every
+// update is guarded by the attempt number, so a worker that lost its job to
+// the sweeper cannot overwrite the outcome of a later attempt.
+func finish(ctx context.Context, logger *slog.Logger, job *Job, runErr error, permanent bool, cfg config.JobsConfig) {
+	// the outcome must be stored even when shutdown cancelled ctx mid-job
+	dbCtx, cancel := database.WithTimeout(context.WithoutCancel(ctx))
+	defer cancel()
+
+	const owned = " WHERE id=$1 AND status='running' AND attempts=$2"
+	var res sql.Result
+	var err error
+	switch {
+	case runErr == nil:
+		res, err = database.DB.ExecContext(dbCtx,
+			"UPDATE jobs SET status='done', last_error=NULL, locked_at=NULL, updated_at=NOW()"+owned, job.ID, job.Attempts)
+		metrics.JobsProcessed.WithLabelValues(job.Kind, "done").Inc()
+	case permanent || job.Attempts >= job.MaxAttempts:
+		res, err = database.DB.ExecContext(dbCtx,
+			"UPDATE jobs SET status='dead', last_error=$3, locked_at=NULL, updated_at=NOW()"+owned, job.ID, job.Attempts, runErr.Error())
+		metrics.JobsProcessed.WithLabelValues(job.Kind, "dead").Inc()
+		logger.Error("Job dead-lettered", "error", runErr)
+	default:
+		delay := backoff(cfg, job.Attempts)
+		res, err = database.DB.ExecContext(dbCtx,
+			"UPDATE jobs SET status='pending', last_error=$3, run_at=NOW() + make_interval(secs => $4), locked_at=NULL, updated_at=NOW()"+owned,
+			job.ID, job.Attempts, runErr.Error(), delay.Seconds())
+		metrics.JobsProcessed.WithLabelValues(job.Kind, "retry").Inc()
+		logger.Warn("Job failed, retrying", "error", runErr, "retry_in", delay)
+	}
+	if err != nil {
+		logger.Error("Recording job outcome failed", "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		logger.Warn("Job outcome discarded: the job was requeued while running")
+	}
+}
+
+// backoff doubles the base delay per attempt up to the cap, then adds up to 20%
+// jitter so a burst of failures does not retry in lockstep
+func backoff(cfg config.JobsConfig, attempt int) time.Duration {
+	delay := cfg.Backoff
+	for i := 1; i < attempt && delay < cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > cfg.MaxBackoff {
+		delay = cfg.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// sweep periodically recovers jobs abandoned by a crashed worker
+func sweep(ctx context.Context, cfg config.JobsConfig) {
+	ticker := time.NewTicker(cfg.Timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := requeueStale(ctx, cfg); err != nil && ctx.Err() == nil {
+				slog.Error("Requeueing stale jobs failed", "error", err)
+			}
+		}
+	}
+}
+
+// requeueStale puts back running jobs whose lock has not been refreshed for
+// twice the job timeout. Live workers heartbeat well within that, so only jobs
+// whose worker died qualify. A job that has used all its attempts is
+// dead-lettered instead, so a job that keeps crashing its worker stops.
+func requeueStale(ctx context.Context, cfg config.JobsConfig) error {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE jobs SET
+			status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			last_error = 'worker stopped responding while running the job',
+			locked_at = NULL, updated_at = NOW()
+		WHERE status='running' AND locked_at < NOW() - make_interval(secs => $1)
+		RETURNING status`
+	rows, err := database.DB.QueryContext(dbCtx, query, (2 * cfg.Timeout).Seconds())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var requeued, dead int
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return err
+		}
+		if status == StatusDead {
+			dead++
+		} else {
+			requeued++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if requeued > 0 {
+		slog.Warn("Requeued jobs abandoned by a worker", "count", requeued)
+	}
+	if dead > 0 {
+		slog.Error("Dead-lettered abandoned jobs out of attempts", "count", dead)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/config"
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFinishIsGuardedByAttempt(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status string
+	}{
+		{"success", nil, "status='done'"},
+		{"retry", errors.New("temporary"), "status='pending'"},
+		{"out of attempts", errors.New("again"), "status='dead'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, nil)
+			job := &Job{ID: 9, Kind: "test", Attempts: 2, MaxAttempts: 3}
+			if tt.status == "status='dead'" {
+				job.Attempts = 3
+			}
+			cfg := config.JobsConfig{Backoff: time.Second, MaxBackoff: time.Minute}
+			finish(context.Background(), slog.Default(), job, tt.err, false, cfg)
+
+			calls := db.Ran("UPDATE jobs")
+			if len(calls) != 1 {
+				t.Fatalf("ran %d updates, want 1", len(calls))
+			}
+			c := calls[0]
+			if !strings.Contains(c.Query, tt.status) || !strings.Contains(c.Query, "status='running' AND attempts=$2") {
+				t.Errorf("query %q is not guarded by the attempt", c.Query)
+			}
+			if c.Args[0] != int64(9) || c.Args[1] != int64(job.Attempts) {
+				t.Errorf("args = %v, want job 9 attempt %d", c.Args, job.Attempts)
+			}
+		})
+	}
+}
+
+func TestRunHeartbeatsWhileHandlerRuns(t *testing.T) {
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Result{RowsAffected: 1}
+	})
+	Register("test.slow", func(context.Context, json.RawMessage) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	cfg := config.JobsConfig{Timeout: 20 * time.Millisecond, Backoff: time.Second, MaxBackoff: time.Minute}
+	run(context.Background(), cfg, &Job{ID: 4, Kind: "test.slow", Attempts: 1, MaxAttempts: 3})
+
+	beats := db.Ran("SET locked_at=NOW()")
+	if len(beats) < 2 {
+		t.Fatalf("refreshed the lock %d times during a run of 5 timeouts", len(beats))
+	}
+	if beats[0].Args[1] != int64(1) {
+		t.Errorf("heartbeat args = %v, want guarded by attempt 1", beats[0].Args)
+	}
+	calls := db.Calls()
+	if last := calls[len(calls)-1].Query; !strings.Contains(last, "status='done'") {
+		t.Errorf("last statement = %q, want the job marked done after the heartbeats stop", last)
+	}
+}
+
+func TestRequeueStaleDeadLettersExhaustedJobs(t *testing.T) {
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Result{Rows: [][]driver.Value{{StatusPending}, {StatusDead}}}
+	})
+
+	if err := requeueStale(context.Background(), config.JobsConfig{Timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	calls := db.Ran("UPDATE jobs")
+	if len(calls) != 1 {
+		t.Fatalf("ran %d updates, want 1", len(calls))
+	}
+	if !strings.Contains(calls[0].Query, "WHEN attempts >= max_attempts THEN 'dead'") {
+		t.Errorf("query %q does not dead-letter exhausted jobs", calls[0].Query)
+	}
+	if calls[0].Args[0] != float64(120) {
+		t.Errorf("stale after %v seconds, want 120", calls[0].Args[0])
+	}
+}
+
+func TestConfigureSetsDefaultMaxAttempts(t *testing.T) {
+	t.Cleanup(func() { defaultMaxAttempts = 5 })
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Row(int64(1))
+	})
+
+	Configure(config.JobsConfig{MaxAttempts: 9})
+	if _, err := Enqueue(context.Background(), database.DB, NewJob{Kind: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	inserts := db.Ran("INSERT INTO jobs")
+	if len(inserts) != 1 || inserts[0].Args[2] != int64(9) {
+		t.Errorf("inserts = %v, want max_attempts 9", inserts)
+	}
+}
+
+func TestLastAttempt(t *testing.T) {
+	dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Result{RowsAffected: 1}
+	})
+	var last bool
+	Register("test.last", func(ctx context.Context, _ json.RawMessage) error {
+		last = LastAttempt(ctx)
+		return nil
+	})
+	cfg := config.JobsConfig{Timeout: time.Second, Backoff: time.Second, MaxBackoff: time.Minute}
+
+	for attempts, want := range map[int]bool{1: false, 2: false, 3: true} {
+		run(context.Background(), cfg, &Job{ID: 4, Kind: "test.last", Attempts: attempts, MaxAttempts: 3})
+		if last != want {
+			t.Errorf("attempt %d of 3: LastAttempt = %v, want %v", attempts, last, want)
+		}
+	}
+	if LastAttempt(context.Background()) {
+		t.Error("LastAttempt outside a job = true")
+	}
+}
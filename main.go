@@ -1,30 +1,128 @@
 package main
 
 import (
+	"context"
+	"e-commerce/config"
 	"e-commerce/database"
+	"e-commerce/handlers"
+	"e-commerce/jobs"
+	"e-commerce/logging"
+	"e-commerce/metrics"
+	"e-commerce/middleware"
+	"e-commerce/notifications"
 	"e-commerce/routes"
-	"fmt"
-	"github.com/joho/godotenv"
-	"github.com/stripe/stripe-go/v78"
-	"log"
+	"e-commerce/services"
+	"e-commerce/tracing"
+	"e-commerce/utils"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// Usage: e-commerce [flags] serves the API with an embedded job worker pool;
+// e-commerce worker [flags] runs only the job workers.
 func main() {
-	err := godotenv.Load()
+	args := os.Args[1:]
+	workerOnly := len(args) > 0 && args[0] == "worker"
+	if workerOnly {
+		args = args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	logging.Setup(cfg.LogLevel)
+
+	utils.ConfigureTokens(cfg.Auth)
+	services.ConfigureInventory(cfg.Inventory)
+	services.ConfigureWebhooks(cfg.Webhooks)
+	services.ConfigureIdempotency(cfg.Idempotency)
+	jobs.Configure(cfg.Jobs)
+	mailer, err := notifications.NewMailer(cfg.Mail)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		slog.Error("Error setting up mailer", "error", err)
+		os.Exit(1)
 	}
+	services.ConfigureNotifications(mailer, cfg.Mail.StoreName)
+	services.Gateway = services.NewStripeGateway(cfg.Stripe)
 
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	if stripe.Key == "" {
-		log.Fatal("STRIPE_SECRET_KEY not set in environment")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Error setting up tracing", "error", err)
+		os.Exit(1)
 	}
-	database.ConnectDB()
+	defer shutdownTracing(context.Background())
+
+	database.ConnectDB(cfg.Database)
 	defer database.CloseDB()
+	metrics.RegisterDBStats(database.DB, "postgres")
+	if database.Replica != nil {
+		metrics.RegisterDBStats(database.Replica, "postgres_replica")
+	}
+
+	if err := registerJobs(cfg); err != nil {
+		slog.Error("Error registering jobs", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	router := routes.SetupRoutes()
-	fmt.Println("Server started on :8080")
-	log.Println(http.ListenAndServe(":8080", router))
+	if workerOnly {
+		runWorker(ctx, cfg)
+		return
+	}
+
+	if cfg.Jobs.Workers > 0 {
+		stopBackground, err := startBackground(cfg)
+		if err != nil {
+			slog.Error("Error starting background workers", "error", err)
+			os.Exit(1)
+		}
+		defer stopBackground()
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           middleware.RequestLogger(middleware.Metrics(routes.SetupRoutes(cfg.Tracing.ServiceName))),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server started", "addr", srv.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server failed", "error", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// stop advertising readiness and keep serving until the orchestrator has
+	// seen /readyz fail, then let in-flight requests finish before the DB closes
+	slog.Info("Shutdown signal received, draining connections", "drain_delay", cfg.Server.DrainDelay)
+	handlers.MarkDraining()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Graceful shutdown failed", "error", err)
+		return
+	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	OrdersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders successfully created at checkout.",
+	})
+
+	PaymentIntentsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "payment_intents_created_total",
+		Help: "Stripe payment intents successfully created.",
+	})
+
+	WebhookEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_webhook_events_total",
+		Help: "Payment webhook deliveries by reported status and processing outcome.",
+	}, []string{"status", "outcome"})
+
+	CartAdds = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cart_adds_total",
+		Help: "Items added to carts.",
+	})
+
+	LowStockEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "inventory_low_stock_events_total",
+		Help: "Times a product's stock fell to or below its low-stock threshold.",
+	})
+
+	OrdersExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_expired_total",
+		Help: "Unpaid orders cancelled after their stock reservation expired.",
+	})
+
+	JobsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Background job attempts by kind and outcome (done, retry, dead).",
+	}, []string{"kind", "outcome"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_duration_seconds",
+		Help:    "Background job attempt latency by kind.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	EventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_events_published_total",
+		Help: "Domain event deliveries from the outbox by sink and outcome.",
+	}, []string{"sink", "outcome"})
+
+	EventsDeadLettered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_events_dead_lettered_total",
+		Help: "Domain events given up on after exhausting their relay attempts.",
+	})
+)
+
+// Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		OrdersCreated,
+		PaymentIntentsCreated,
+		WebhookEvents,
+		CartAdds,
+		LowStockEvents,
+		OrdersExpired,
+		JobsProcessed,
+		JobDuration,
+		EventsPublished,
+		EventsDeadLettered,
+	)
+}
+
+// RegisterDBStats exposes the connection pool statistics from db.Stats() under dbName
+func RegisterDBStats(db *sql.DB, dbName string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
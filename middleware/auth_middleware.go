@@ -33,6 +33,7 @@ func AuthMiddleWare(next http.Handler) http.Handler {
 		// Set user ID and admin status in the request context
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
 		ctx = context.WithValue(ctx, IsAdminKey, isAdmin)
+		ctx = setRequestUser(ctx, userID)
 
 		next.ServeHTTP(w, r.WithContext(ctx)) // Pass context along with the request
 	})
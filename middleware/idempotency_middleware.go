@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"e-commerce/logging"
+	"e-commerce/services"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotentBody    = 1 << 20
+)
+
+// bufferingRecorder passes the response through while keeping a copy for replay
+type bufferingRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (rec *bufferingRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Idempotent makes a POST safe to retry. The first request with a given
+// Idempotency-Key runs normally and its response is stored; retries with the same
+// body get the stored response, and reuse with a different body is rejected with 409.
+// Requests without the header are passed through unchanged. Bodies over 1 MB are
+// rejected with 413, since only the whole body can fingerprint the request.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIdempotentBody {
+			http.Error(w, "Request body too large for an idempotent request", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		endpoint := r.Method + " " + r.URL.Path
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		logger := logging.FromContext(r.Context())
+		existing, err := services.ReserveIdempotencyKey(r.Context(), userID, endpoint, key, fingerprint)
+		if err != nil {
+			logger.Error("idempotency lookup failed", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.RequestHash != fingerprint:
+				http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusConflict)
+			case existing.StatusCode == 0:
+				http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+			default:
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.StatusCode)
+				w.Write(existing.ResponseBody)
+			}
+			return
+		}
+
+		// the response is already sent, so storing it must not depend on the client staying connected
+		ctx := context.WithoutCancel(r.Context())
+
+		// a panicking handler must not leave the key in progress, or every retry gets 409
+		finished := false
+		defer func() {
+			if finished {
+				return
+			}
+			if err := services.ReleaseIdempotencyKey(ctx, userID, endpoint, key); err != nil {
+				logger.Error("releasing idempotency key failed", "error", err)
+			}
+		}()
+
+		rec := &bufferingRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		next.ServeHTTP(rec, r)
+		finished = true
+
+		if rec.status >= http.StatusInternalServerError {
+			err = services.ReleaseIdempotencyKey(ctx, userID, endpoint, key)
+		} else {
+			err = services.CompleteIdempotencyKey(ctx, userID, endpoint, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		}
+		if err != nil {
+			logger.Error("storing idempotency result failed", "error", err)
+		}
+	})
+}
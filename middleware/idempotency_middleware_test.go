@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func idempotentRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/order", strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, "key-1")
+	return r.WithContext(context.WithValue(r.Context(), UserIDKey, 7))
+}
+
+// reserved answers the key reservation as won by this request
+func reserved(query string, args []driver.Value) dbtest.Result {
+	if strings.Contains(query, "INSERT INTO idempotency_keys") {
+		return dbtest.Row(int64(1))
+	}
+	return dbtest.Result{RowsAffected: 1}
+}
+
+func TestIdempotentStoresResponse(t *testing.T) {
+	db := dbtest.New(t, reserved)
+
+	w := httptest.NewRecorder()
+	Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})).ServeHTTP(w, idempotentRequest(`{"address_id":1}`))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", w.Code)
+	}
+	updates := db.Ran("UPDATE idempotency_keys")
+	if len(updates) != 1 || updates[0].Args[0] != int64(http.StatusCreated) || string(updates[0].Args[2].([]byte)) != `{"id":1}` {
+		t.Errorf("stored %v, want the 201 response", updates)
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	db := dbtest.New(t, reserved)
+
+	handler := Idempotent(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`))
+	}()
+
+	if len(db.Ran("DELETE FROM idempotency_keys")) != 1 {
+		t.Error("key was not released after the panic")
+	}
+	if len(db.Ran("UPDATE idempotency_keys")) != 0 {
+		t.Error("a response was stored for the panicking request")
+	}
+}
+
+func TestIdempotentRejectsOversizedBody(t *testing.T) {
+	db := dbtest.New(t, reserved)
+
+	called := false
+	w := httptest.NewRecorder()
+	body := `{"note":"` + strings.Repeat("x", maxIdempotentBody) + `"}`
+	Idempotent(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })).
+		ServeHTTP(w, idempotentRequest(body))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+	if called || len(db.Calls()) != 0 {
+		t.Error("an oversized request reached the handler or the database")
+	}
+}
+
+func TestIdempotentRequestInProgress(t *testing.T) {
+	dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "SELECT request_hash") {
+			// same body, no response yet
+			return dbtest.Row("44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", nil, nil, nil)
+		}
+		return dbtest.Result{}
+	})
+
+	w := httptest.NewRecorder()
+	Idempotent(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler ran while the key was held")
+	})).ServeHTTP(w, idempotentRequest(`{}`))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"e-commerce/logging"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// requestState is shared by pointer so inner middleware (routing, auth) can
+// report the route and user back to the access log and metrics that wrap it.
+// route stays empty when no route matched.
+type requestState struct {
+	route   string
+	traceID string
+	userID  int
+}
+
+const requestStateKey contextKey = "request_state"
+
+// statusRecorder captures the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// RequestLogger propagates or generates X-Request-ID, attaches a request-scoped
+// logger to the context and writes one access log line per request. It wraps
+// the whole router so requests no route matched (404, 405) are logged too;
+// RequestRoute fills in the route template for the ones that did match.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		ctx, state := withRequestState(logging.WithLogger(r.Context(), logger))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		route := state.route
+		if route == "" {
+			route = r.URL.Path
+		}
+		attrs := []any{
+			"method", r.Method,
+			"route", route,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", time.Since(start).Milliseconds(),
+		}
+		if state.traceID != "" {
+			attrs = append(attrs, "trace_id", state.traceID)
+		}
+		if state.userID != 0 {
+			attrs = append(attrs, "user_id", state.userID)
+		}
+		logger.Info("request completed", attrs...)
+	})
+}
+
+// RequestRoute is router middleware reporting the matched route template to
+// RequestLogger and Metrics. It runs after the tracing middleware, so it also adds the
+// trace ID to the request logger.
+func RequestRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		state, _ := ctx.Value(requestStateKey).(*requestState)
+		if state == nil {
+			state = &requestState{}
+		}
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				state.route = tmpl
+			}
+		}
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+			state.traceID = spanCtx.TraceID().String()
+			ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("trace_id", state.traceID))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withRequestState returns the request state already on ctx, or attaches a new one
+func withRequestState(ctx context.Context) (context.Context, *requestState) {
+	if state, ok := ctx.Value(requestStateKey).(*requestState); ok {
+		return ctx, state
+	}
+	state := &requestState{}
+	return context.WithValue(ctx, requestStateKey, state), state
+}
+
+// setRequestUser records the authenticated user on the request state and returns
+// a context whose logger carries the user ID
+func setRequestUser(ctx context.Context, userID int) context.Context {
+	if state, ok := ctx.Value(requestStateKey).(*requestState); ok {
+		state.userID = userID
+	}
+	return logging.WithLogger(ctx, logging.FromContext(ctx).With("user_id", userID))
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
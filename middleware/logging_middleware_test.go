@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequestLoggerLogsUnmatchedRequests(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	router := mux.NewRouter()
+	router.Use(RequestRoute)
+	router.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	handler := RequestLogger(router)
+
+	tests := []struct {
+		method, path string
+		status       int
+		route        string
+	}{
+		{"GET", "/items/3", http.StatusOK, "/items/{id}"},
+		{"GET", "/missing", http.StatusNotFound, "/missing"},
+		{"POST", "/items/3", http.StatusMethodNotAllowed, "/items/3"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		var entry struct {
+			Msg       string
+			Status    int
+			Route     string
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%s %s: no access log line: %q", tt.method, tt.path, buf.String())
+		}
+		if entry.Msg != "request completed" || entry.Status != tt.status || entry.Route != tt.route {
+			t.Errorf("%s %s: logged %+v, want status %d route %s", tt.method, tt.path, entry, tt.status, tt.route)
+		}
+		if entry.RequestID == "" || w.Header().Get(RequestIDHeader) != entry.RequestID {
+			t.Errorf("%s %s: request ID %q not echoed in the response", tt.method, tt.path, entry.RequestID)
+		}
+	}
+}
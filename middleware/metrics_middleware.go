@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"e-commerce/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics records request counts and latency per mux route template. Using the
+// template rather than the raw path keeps label cardinality bounded. Like
+// RequestLogger it wraps the whole router, so 404s and 405s are counted under
+// the "unmatched" route; RequestRoute reports the template for the rest.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, state := withRequestState(r.Context())
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		route := state.route
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
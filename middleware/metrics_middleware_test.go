@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"e-commerce/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCountsRouteTemplateAndStatus(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RequestRoute)
+	router.HandleFunc("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "0" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}).Methods("GET")
+	handler := RequestLogger(Metrics(router))
+
+	tests := []struct {
+		method, path  string
+		route, status string
+	}{
+		{"GET", "/widgets/3", "/widgets/{id}", "200"},
+		{"GET", "/widgets/0", "/widgets/{id}", "400"},
+		{"GET", "/nowhere", "unmatched", "404"},
+		{"DELETE", "/widgets/3", "unmatched", "405"},
+	}
+	for _, tt := range tests {
+		counter := metrics.HTTPRequests.WithLabelValues(tt.method, tt.route, tt.status)
+		before := testutil.ToFloat64(counter)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("%s %s: counted %v times under route %q status %s, want 1", tt.method, tt.path, got, tt.route, tt.status)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/nowhere", "404")); got != 0 {
+		t.Errorf("unmatched request counted under its raw path %v times", got)
+	}
+}
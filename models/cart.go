@@ -3,9 +3,12 @@ package models
 import "time"
 
 type Cart struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	ProductID int       `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int `json:"id"`
+	UserID    int `json:"user_id"`
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+	// UnitPrice is the product's effective price, including any sale
+	UnitPrice      float64   `json:"unit_price"`
+	CompareAtPrice *float64  `json:"compare_at_price,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+)
+
+type Coupon struct {
+	ID             int        `json:"id"`
+	Code           string     `json:"code"`
+	Type           string     `json:"type"`
+	Value          float64    `json:"value"`
+	MinOrderValue  float64    `json:"min_order_value"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	MaxUses        *int       `json:"max_uses,omitempty"`
+	MaxUsesPerUser *int       `json:"max_uses_per_user,omitempty"`
+	UsedCount      int        `json:"used_count"`
+	ProductID      *int       `json:"product_id,omitempty"`
+	Category       *string    `json:"category,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
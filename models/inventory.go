@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	MovementReceipt     = "receipt"
+	MovementSale        = "sale"
+	MovementReturn      = "return"
+	MovementAdjustment  = "adjustment"
+	MovementReservation = "reservation"
+)
+
+// InventoryMovement is one entry in a product's stock ledger. Quantity is signed:
+// positive movements add stock, negative ones take it away. Balance is the
+// product's stock right after the movement.
+type InventoryMovement struct {
+	ID        int       `json:"id"`
+	ProductID int       `json:"product_id"`
+	Kind      string    `json:"kind"`
+	Quantity  int       `json:"quantity"`
+	Balance   int       `json:"balance"`
+	OrderID   *int      `json:"order_id,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy *int      `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
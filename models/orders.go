@@ -3,9 +3,29 @@ package models
 import "time"
 
 type Orders struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               int     `json:"id"`
+	UserID           int     `json:"user_id"`
+	Subtotal         float64 `json:"subtotal"`
+	Discount         float64 `json:"discount"`
+	CouponCode       *string `json:"coupon_code,omitempty"`
+	ShippingMethodID *int    `json:"shipping_method_id,omitempty"`
+	ShippingCost     float64 `json:"shipping_cost"`
+	Tax              float64 `json:"tax"`
+	Total            float64 `json:"total"`
+	Status           string  `json:"status"`
+	// ShippingAddress is nil only for orders placed before addresses existed
+	ShippingAddress *AddressSnapshot `json:"shipping_address,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	Items           []OrderItem      `json:"items,omitempty"`
+}
+
+type OrderItem struct {
+	ID        int     `json:"id"`
+	OrderID   int     `json:"order_id"`
+	ProductID int     `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Discount  float64 `json:"discount"`
+	Tax       float64 `json:"tax"`
+	LineTotal float64 `json:"line_total"`
 }
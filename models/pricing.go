@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ScheduledPrice replaces a product's list price from StartsAt until EndsAt, or
+// indefinitely without an end
+type ScheduledPrice struct {
+	ID             int        `json:"id"`
+	ProductID      int        `json:"product_id"`
+	SalePrice      float64    `json:"sale_price"`
+	CompareAtPrice *float64   `json:"compare_at_price,omitempty"`
+	StartsAt       time.Time  `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type ScheduledPriceRequest struct {
+	SalePrice      float64    `json:"sale_price" validate:"gt=0"`
+	CompareAtPrice *float64   `json:"compare_at_price" validate:"gt=0"`
+	StartsAt       *time.Time `json:"starts_at" validate:"required"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
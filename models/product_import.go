@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Product import states
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	// ImportFailed is an import stopped by an error rather than by bad rows;
+	// the counts cover the rows processed before it
+	ImportFailed = "failed"
+)
+
+// ProductImport is the report of one bulk import. In a dry run Created, Updated
+// and Unchanged count what the import would have done.
+type ProductImport struct {
+	ID        int    `json:"id"`
+	Format    string `json:"format"`
+	DryRun    bool   `json:"dry_run"`
+	Status    string `json:"status"`
+	TotalRows int    `json:"total_rows"`
+	Processed int    `json:"processed_rows"`
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	Failed    int    `json:"failed"`
+	// Errors lists the first failing rows; Failed has the full count
+	Errors     []ImportRowError `json:"errors"`
+	CreatedBy  *int             `json:"created_by,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// ImportRowError explains why one row was rejected. Row is the line number in
+// the file, counting the CSV header.
+type ImportRowError struct {
+	Row    int      `json:"row"`
+	SKU    string   `json:"sku,omitempty"`
+	Errors []string `json:"errors"`
+}
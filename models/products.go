@@ -3,10 +3,32 @@ package models
 import "time"
 
 type Products struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	Stock       int       `json:"stock"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID int `json:"id"`
+	// SKU is the merchant's identifier, used to match rows in bulk imports
+	SKU         *string `json:"sku,omitempty"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	// EffectivePrice is what the product sells for now: the sale price of the
+	// scheduled price in effect, or Price. CompareAtPrice is only set while the
+	// sale price is below it.
+	EffectivePrice float64    `json:"effective_price"`
+	CompareAtPrice *float64   `json:"compare_at_price,omitempty"`
+	SaleID         *int       `json:"sale_id,omitempty"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty"`
+	Stock          int        `json:"stock"`
+	Category       string     `json:"category"`
+	TaxClass       string     `json:"tax_class"`
+	Weight         float64    `json:"weight"`
+	// LowStockThreshold overrides the store-wide default when set
+	LowStockThreshold *int `json:"low_stock_threshold,omitempty"`
+	// AverageRating and RatingCount cover approved reviews only
+	AverageRating float64 `json:"average_rating"`
+	RatingCount   int     `json:"rating_count"`
+	// ArchivedAt is set once the product is archived and off the storefront
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// Version increases on every update, including changes to the price
+	// schedule, and is part of the ETag
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
 }
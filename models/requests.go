@@ -0,0 +1,189 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Request DTOs decoded from JSON bodies. Each carries the validation rules
+// applied by utils.Validate before the handler touches the database.
+
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72,password"`
+	// Locale picks the language of emails and defaults to English
+	Locale string `json:"locale" validate:"max=10"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ProductRequest creates a product; Stock is its opening balance. It is also the
+// shape of import rows, where stock is the target balance.
+type ProductRequest struct {
+	SKU               *string `json:"sku" validate:"max=64"`
+	Name              string  `json:"name" validate:"required,max=255"`
+	Description       string  `json:"description"`
+	Price             float64 `json:"price" validate:"gt=0"`
+	Stock             int     `json:"stock" validate:"min=0"`
+	Category          string  `json:"category" validate:"max=100"`
+	TaxClass          string  `json:"tax_class" validate:"max=50"`
+	Weight            float64 `json:"weight" validate:"min=0"`
+	LowStockThreshold *int    `json:"low_stock_threshold" validate:"min=0"`
+}
+
+// ProductUpdateRequest replaces a product's catalog fields. Stock only changes
+// through the inventory ledger, so a body carrying it is rejected rather than
+// having it silently ignored. Leaving sku out keeps the current SKU; null
+// clears it.
+type ProductUpdateRequest struct {
+	SKU               *string `json:"sku" validate:"max=64"`
+	Name              string  `json:"name" validate:"required,max=255"`
+	Description       string  `json:"description"`
+	Price             float64 `json:"price" validate:"gt=0"`
+	Stock             *int    `json:"stock"`
+	Category          string  `json:"category" validate:"max=100"`
+	TaxClass          string  `json:"tax_class" validate:"max=50"`
+	Weight            float64 `json:"weight" validate:"min=0"`
+	LowStockThreshold *int    `json:"low_stock_threshold" validate:"min=0"`
+	// SKUSent is set when the body has a sku field, even a null one
+	SKUSent bool `json:"-"`
+}
+
+// UnmarshalJSON decodes the request and notes whether sku was sent
+func (r *ProductUpdateRequest) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	_, r.SKUSent = fields["sku"]
+	type plain ProductUpdateRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+type AddToCartRequest struct {
+	ProductID int `json:"product_id" validate:"required,min=1"`
+	Quantity  int `json:"quantity" validate:"min=1"`
+}
+
+type AddressRequest struct {
+	FullName          string `json:"full_name" validate:"required,max=200"`
+	Line1             string `json:"line1" validate:"required,max=255"`
+	Line2             string `json:"line2" validate:"max=255"`
+	City              string `json:"city" validate:"required,max=100"`
+	Region            string `json:"region" validate:"max=100"`
+	PostalCode        string `json:"postal_code" validate:"required,max=20"`
+	Country           string `json:"country" validate:"required,min=2,max=2"`
+	Phone             string `json:"phone" validate:"max=30"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+// CreateOrderRequest picks the shipping address from the address book and a
+// shipping method from GET /api/shipping/options. Without an address ID the
+// default shipping address is used; without a method the cheapest option is.
+type CreateOrderRequest struct {
+	AddressID        *int `json:"address_id" validate:"min=1"`
+	ShippingMethodID *int `json:"shipping_method_id" validate:"min=1"`
+}
+
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=Not Paid|Paid|Pending|Partially Shipped|Shipped|Delivered|Cancelled"`
+}
+
+type PaymentIntentRequest struct {
+	OrderID int `json:"order_id" validate:"required,min=1"`
+}
+
+type CouponRequest struct {
+	Code           string     `json:"code" validate:"required,max=50"`
+	Type           string     `json:"type" validate:"required,oneof=percentage|fixed|free_shipping"`
+	Value          float64    `json:"value" validate:"min=0"`
+	MinOrderValue  float64    `json:"min_order_value" validate:"min=0"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxUses        *int       `json:"max_uses" validate:"min=1"`
+	MaxUsesPerUser *int       `json:"max_uses_per_user" validate:"min=1"`
+	ProductID      *int       `json:"product_id" validate:"min=1"`
+	Category       *string    `json:"category" validate:"max=100"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" validate:"required,max=50"`
+}
+
+// WebhookSubscriptionRequest creates or replaces a merchant webhook. A secret is
+// generated when none is given.
+type WebhookSubscriptionRequest struct {
+	URL        string   `json:"url" validate:"required,max=2048"`
+	EventTypes []string `json:"event_types" validate:"min=1"`
+	Secret     string   `json:"secret" validate:"max=255"`
+	Active     *bool    `json:"active"`
+}
+
+// StockMovementRequest records a manual ledger entry. Receipts and returns add
+// stock; adjustments may go either way, e.g. -3 after a stock count.
+type StockMovementRequest struct {
+	Kind     string `json:"kind" validate:"required,oneof=receipt|return|adjustment"`
+	Quantity int    `json:"quantity" validate:"required"`
+	Note     string `json:"note" validate:"max=255"`
+}
+
+type ShippingRateRequest struct {
+	MinWeight   float64  `json:"min_weight" validate:"min=0"`
+	MaxWeight   *float64 `json:"max_weight" validate:"gt=0"`
+	MinSubtotal float64  `json:"min_subtotal" validate:"min=0"`
+	MaxSubtotal *float64 `json:"max_subtotal" validate:"gt=0"`
+	Price       float64  `json:"price" validate:"min=0"`
+}
+
+type ShippingMethodRequest struct {
+	Code    string                `json:"code" validate:"required,max=50"`
+	Name    string                `json:"name" validate:"required,max=100"`
+	Carrier string                `json:"carrier" validate:"required,max=100"`
+	Rates   []ShippingRateRequest `json:"rates" validate:"min=1"`
+}
+
+// ShipmentRequest records a (possibly partial) shipment; with no items, every
+// unit not yet shipped is included
+type ShipmentRequest struct {
+	Carrier        string         `json:"carrier" validate:"required,max=100"`
+	TrackingNumber string         `json:"tracking_number" validate:"required,max=100"`
+	Items          []ShipmentItem `json:"items"`
+}
+
+// NotificationPreferencesRequest replaces a user's preferences; OptOuts entries
+// must be notification kinds, which the handler checks
+type NotificationPreferencesRequest struct {
+	Locale  string   `json:"locale" validate:"required,max=10"`
+	OptOuts []string `json:"opt_outs"`
+}
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" validate:"required,min=1,max=5"`
+	Title  string `json:"title" validate:"required,max=255"`
+	Body   string `json:"body" validate:"max=5000"`
+}
+
+type ReviewStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=pending|approved|rejected"`
+}
+
+type WishlistRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type WishlistItemRequest struct {
+	ProductID int `json:"product_id" validate:"required,min=1"`
+}
+
+// MoveToCartRequest moves a wishlist item into the cart; Quantity defaults to 1
+type MoveToCartRequest struct {
+	Quantity *int `json:"quantity" validate:"min=1"`
+}
+
+type MoveToWishlistRequest struct {
+	WishlistID int `json:"wishlist_id" validate:"required,min=1"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"e-commerce/utils"
+	"strings"
+	"testing"
+)
+
+// TestRequestRulesAreKnown catches validate tags the validator does not
+// implement, which would otherwise reject every request using them
+func TestRequestRulesAreKnown(t *testing.T) {
+	requests := []interface{}{
+		&RegisterRequest{}, &LoginRequest{}, &ProductRequest{}, &AddToCartRequest{}, &AddressRequest{},
+		&CreateOrderRequest{}, &UpdateOrderStatusRequest{}, &PaymentIntentRequest{},
+		&CouponRequest{}, &ProductUpdateRequest{}, &ApplyCouponRequest{}, &WebhookSubscriptionRequest{}, &StockMovementRequest{},
+		&ShippingRateRequest{}, &ShippingMethodRequest{Rates: []ShippingRateRequest{{}}},
+		&ShipmentRequest{}, &NotificationPreferencesRequest{}, &ReviewRequest{}, &ReviewStatusRequest{},
+		&WishlistRequest{}, &WishlistItemRequest{}, &MoveToCartRequest{}, &MoveToWishlistRequest{},
+		&ScheduledPriceRequest{},
+	}
+	for _, req := range requests {
+		for field, msgs := range utils.Validate(req) {
+			for _, msg := range msgs {
+				if strings.Contains(msg, "unknown rule") || strings.Contains(msg, "invalid") {
+					t.Errorf("%T.%s %s", req, field, msg)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type ShippingMethod struct {
+	ID        int            `json:"id"`
+	Code      string         `json:"code"`
+	Name      string         `json:"name"`
+	Carrier   string         `json:"carrier"`
+	Active    bool           `json:"active"`
+	CreatedAt time.Time      `json:"created_at"`
+	Rates     []ShippingRate `json:"rates"`
+}
+
+// ShippingRate prices a method for carts whose weight (kg) and subtotal fall in
+// [min, max); a nil max is unbounded
+type ShippingRate struct {
+	ID          int      `json:"id"`
+	MethodID    int      `json:"method_id"`
+	MinWeight   float64  `json:"min_weight"`
+	MaxWeight   *float64 `json:"max_weight,omitempty"`
+	MinSubtotal float64  `json:"min_subtotal"`
+	MaxSubtotal *float64 `json:"max_subtotal,omitempty"`
+	Price       float64  `json:"price"`
+}
+
+// ShippingOption is a method the customer can pick for the current cart
+type ShippingOption struct {
+	MethodID int     `json:"shipping_method_id"`
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	Carrier  string  `json:"carrier"`
+	Price    float64 `json:"price"`
+}
+
+type Shipment struct {
+	ID             int            `json:"id"`
+	OrderID        int            `json:"order_id"`
+	Carrier        string         `json:"carrier"`
+	TrackingNumber string         `json:"tracking_number"`
+	ShippedAt      time.Time      `json:"shipped_at"`
+	Items          []ShipmentItem `json:"items"`
+}
+
+type ShipmentItem struct {
+	OrderItemID int `json:"order_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"min=1"`
+}
@@ -10,3 +10,10 @@ type User struct {
 	IsAdmin   bool      `json:"isadmin"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// NotificationPreferences is a user's email language and the notification
+// kinds they opted out of
+type NotificationPreferences struct {
+	Locale  string   `json:"locale"`
+	OptOuts []string `json:"opt_outs"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Wishlist struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id,omitempty"`
+	Name   string `json:"name"`
+	// ShareToken is set while the list is shared via /shared/wishlists/{token}
+	ShareToken *string        `json:"share_token,omitempty"`
+	ItemCount  int            `json:"item_count"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Items      []WishlistItem `json:"items,omitempty"`
+}
+
+// WishlistItem shows the product as it is now, not as it was when added
+type WishlistItem struct {
+	ProductID int       `json:"product_id"`
+	Name      string    `json:"name"`
+	Price     float64   `json:"price"`
+	InStock   bool      `json:"in_stock"`
+	AddedAt   time.Time `json:"added_at"`
+}
@@ -0,0 +1,137 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"e-commerce/config"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Message is one rendered email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends rendered messages. Send is called from a job, so a returned
+// error is retried with backoff.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// NewMailer builds the mailer selected by MAILER
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Mailer {
+	case "smtp":
+		return SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.From, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.CaptureDir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating mail capture directory: %w", err)
+		}
+		return FileMailer{Dir: cfg.CaptureDir, From: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Mailer)
+	}
+}
+
+// SMTPMailer relays messages through an SMTP server, authenticating with PLAIN
+// when a username is set. net/smtp upgrades to TLS when the server offers it.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPMailer) Send(ctx context.Context, m Message) error {
+	body, err := encode(s.From, m)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// smtp.SendMail takes no context, so give up waiting when ctx ends
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, body) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer writes each message as an .eml file in Dir instead of sending it;
+// for development and for asserting on outgoing mail in tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (f FileMailer) Send(_ context.Context, m Message) error {
+	body, err := encode(f.From, m)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(f.Dir, name), body, 0o644)
+}
+
+// encode builds a multipart/alternative message with the text part first, so
+// clients that cannot show HTML fall back to it
+func encode(from string, m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
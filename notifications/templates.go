@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"e-commerce/models"
+)
+
+// Notification kinds. Each has a <kind>.txt and <kind>.html template per
+// locale, and the text file also defines a "<kind>.subject" template.
+const (
+	OrderConfirmation = "order_confirmation"
+	OrderShipped      = "order_shipped"
+	PaymentFailed     = "payment_failed"
+	BackInStock       = "back_in_stock"
+	PriceDrop         = "price_drop"
+)
+
+// Kinds lists every notification a user can opt out of
+var Kinds = []string{OrderConfirmation, OrderShipped, PaymentFailed, BackInStock, PriceDrop}
+
+// DefaultLocale is used for users without a locale and for locales without templates
+const DefaultLocale = "en"
+
+// Data is what every template is executed with. Order emails fill in Order,
+// Items and Shipments; wishlist emails fill in Product.
+type Data struct {
+	StoreName string
+	Username  string
+	Product   models.Products
+	Order     models.Orders
+	Items     []Item
+	Shipments []models.Shipment
+}
+
+// Item is an order line with the product name resolved
+type Item struct {
+	Name      string
+	Quantity  int
+	UnitPrice float64
+	LineTotal float64
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = map[string]interface{}{
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+}
+
+type localeTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var locales = mustParse()
+
+// mustParse loads every locale directory at startup so a broken template fails
+// the process instead of the first email that uses it
+func mustParse() map[string]localeTemplates {
+	dirs, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	parsed := make(map[string]localeTemplates)
+	for _, dir := range dirs {
+		locale := dir.Name()
+		parsed[locale] = localeTemplates{
+			text: texttemplate.Must(texttemplate.New(locale).Funcs(funcs).ParseFS(templateFS, "templates/"+locale+"/*.txt")),
+			html: htmltemplate.Must(htmltemplate.New(locale).Funcs(funcs).ParseFS(templateFS, "templates/"+locale+"/*.html")),
+		}
+	}
+	if _, ok := parsed[DefaultLocale]; !ok {
+		panic("notifications: missing templates for default locale " + DefaultLocale)
+	}
+	return parsed
+}
+
+// SupportedLocale reports whether templates exist for locale
+func SupportedLocale(locale string) bool {
+	_, ok := locales[locale]
+	return ok
+}
+
+// Render executes the templates for kind in locale, falling back to the default
+// locale, and returns the message without a recipient
+func Render(kind, locale string, data Data) (Message, error) {
+	t, ok := locales[locale]
+	if !ok {
+		t = locales[DefaultLocale]
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&text, kind+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.ExecuteTemplate(&subject, kind+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html.ExecuteTemplate(&html, kind+".html", data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: strings.TrimSpace(subject.String()), Text: text.String(), HTML: html.String()}, nil
+}
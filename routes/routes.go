@@ -2,39 +2,107 @@ package routes
 
 import (
 	"e-commerce/handlers"
+	"e-commerce/metrics"
 	"e-commerce/middleware"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"net/http"
 )
 
-func SetupRoutes() *mux.Router {
+// SetupRoutes builds the router; serviceName names the server spans
+func SetupRoutes(serviceName string) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(otelmux.Middleware(serviceName))
+	router.Use(middleware.RequestRoute)
+
+	router.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})).Methods("GET")
+	router.HandleFunc("/healthz", handlers.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", handlers.Readyz).Methods("GET")
 
 	router.HandleFunc("/register", handlers.RegisterUser).Methods("POST")
 	router.HandleFunc("/login", handlers.LoginUser).Methods("POST")
+	router.HandleFunc("/shared/wishlists/{token}", handlers.ViewSharedWishlist).Methods("GET")
+
+	// Stripe signs its webhook calls instead of sending a user token
+	router.HandleFunc("/api/webhook", handlers.HandleWebhook).Methods("POST")
 
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(middleware.AuthMiddleWare)
 	api.HandleFunc("/products", handlers.GetProducts).Methods("GET")
 	api.HandleFunc("/products/{id}", handlers.GetProductByID).Methods("GET")
-	api.HandleFunc("/order", handlers.CreateOrder).Methods("POST")
+	api.HandleFunc("/products/{id:[0-9]+}/reviews", handlers.CreateReview).Methods("POST")
+	api.HandleFunc("/products/{id:[0-9]+}/reviews", handlers.ListProductReviews).Methods("GET")
+	api.Handle("/order", middleware.Idempotent(http.HandlerFunc(handlers.CreateOrder))).Methods("POST")
 	api.HandleFunc("/orders", handlers.ViewOrders).Methods("GET")
 	api.HandleFunc("/orders/{id:[0-9]+}", handlers.ViewOrderDetails).Methods("GET")
 	api.HandleFunc("/orders/{id:[0-9]+}/cancel", handlers.CancelOrder).Methods("DELETE")
+	api.HandleFunc("/orders/{id:[0-9]+}/shipments", handlers.ListShipments).Methods("GET")
+	api.HandleFunc("/shipping/options", handlers.ShippingOptions).Methods("GET")
 	api.HandleFunc("/cart", handlers.AddToCart).Methods("POST")
 	api.HandleFunc("/cart", handlers.ViewCart).Methods("GET")
 	api.HandleFunc("/cart/{product_id:[0-9]+}", handlers.RemoveFromCart).Methods("DELETE")
+	api.HandleFunc("/cart/coupon", handlers.ApplyCoupon).Methods("POST")
+	api.HandleFunc("/cart/coupon", handlers.RemoveCoupon).Methods("DELETE")
+	api.HandleFunc("/cart/{product_id:[0-9]+}/save-for-later", handlers.SaveForLater).Methods("POST")
+	api.HandleFunc("/wishlists", handlers.ListWishlists).Methods("GET")
+	api.HandleFunc("/wishlists", handlers.CreateWishlist).Methods("POST")
+	api.HandleFunc("/wishlists/{id:[0-9]+}", handlers.GetWishlist).Methods("GET")
+	api.HandleFunc("/wishlists/{id:[0-9]+}", handlers.RenameWishlist).Methods("PUT")
+	api.HandleFunc("/wishlists/{id:[0-9]+}", handlers.DeleteWishlist).Methods("DELETE")
+	api.HandleFunc("/wishlists/{id:[0-9]+}/items", handlers.AddWishlistItem).Methods("POST")
+	api.HandleFunc("/wishlists/{id:[0-9]+}/items/{product_id:[0-9]+}", handlers.RemoveWishlistItem).Methods("DELETE")
+	api.HandleFunc("/wishlists/{id:[0-9]+}/items/{product_id:[0-9]+}/move-to-cart", handlers.MoveWishlistItemToCart).Methods("POST")
+	api.HandleFunc("/wishlists/{id:[0-9]+}/share", handlers.ShareWishlist).Methods("POST")
+	api.HandleFunc("/wishlists/{id:[0-9]+}/share", handlers.UnshareWishlist).Methods("DELETE")
+	api.HandleFunc("/notifications/preferences", handlers.GetNotificationPreferences).Methods("GET")
+	api.HandleFunc("/notifications/preferences", handlers.UpdateNotificationPreferences).Methods("PUT")
+	api.HandleFunc("/addresses", handlers.ListAddresses).Methods("GET")
+	api.HandleFunc("/addresses", handlers.CreateAddress).Methods("POST")
+	api.HandleFunc("/addresses/{id:[0-9]+}", handlers.GetAddress).Methods("GET")
+	api.HandleFunc("/addresses/{id:[0-9]+}", handlers.UpdateAddress).Methods("PUT")
+	api.HandleFunc("/addresses/{id:[0-9]+}", handlers.DeleteAddress).Methods("DELETE")
 
 	admin := api.PathPrefix("/admin").Subrouter()
 	admin.Use(middleware.AdminMiddleware)
 
 	admin.HandleFunc("/products", handlers.AddProduct).Methods("POST")
 	admin.HandleFunc("/products/{id:[0-9]+}", handlers.UpdateProduct).Methods("PUT")
+	admin.HandleFunc("/products/{id:[0-9]+}", handlers.PatchProduct).Methods("PATCH")
 	admin.HandleFunc("/products/{id:[0-9]+}", handlers.DeleteProduct).Methods("DELETE")
+	admin.HandleFunc("/products/{id:[0-9]+}/restore", handlers.RestoreProduct).Methods("POST")
+	admin.HandleFunc("/products/archived", handlers.ListArchivedProducts).Methods("GET")
+	admin.HandleFunc("/products/import", handlers.ImportProducts).Methods("POST")
+	admin.HandleFunc("/products/imports/{id:[0-9]+}", handlers.GetProductImport).Methods("GET")
+	admin.HandleFunc("/products/export", handlers.ExportProducts).Methods("GET")
+	admin.HandleFunc("/products/{id:[0-9]+}/stock", handlers.RecordStockMovement).Methods("POST")
+	admin.HandleFunc("/products/{id:[0-9]+}/stock", handlers.StockHistory).Methods("GET")
+	admin.HandleFunc("/products/{id:[0-9]+}/prices", handlers.ListScheduledPrices).Methods("GET")
+	admin.HandleFunc("/products/{id:[0-9]+}/prices", handlers.CreateScheduledPrice).Methods("POST")
+	admin.HandleFunc("/products/{id:[0-9]+}/prices/{price_id:[0-9]+}", handlers.UpdateScheduledPrice).Methods("PUT")
+	admin.HandleFunc("/products/{id:[0-9]+}/prices/{price_id:[0-9]+}", handlers.DeleteScheduledPrice).Methods("DELETE")
+	admin.HandleFunc("/inventory/low-stock", handlers.LowStockProducts).Methods("GET")
+	admin.HandleFunc("/reviews", handlers.ListReviews).Methods("GET")
+	admin.HandleFunc("/reviews/{id:[0-9]+}/status", handlers.ModerateReview).Methods("PUT")
+	admin.HandleFunc("/reviews/{id:[0-9]+}", handlers.DeleteReview).Methods("DELETE")
 	admin.HandleFunc("/orders/{id:[0-9]+}/status", handlers.UpdateOrderStatus).Methods("PUT")
+	admin.HandleFunc("/coupons", handlers.CreateCoupon).Methods("POST")
+	admin.HandleFunc("/coupons", handlers.ListCoupons).Methods("GET")
+	admin.HandleFunc("/shipping/methods", handlers.CreateShippingMethod).Methods("POST")
+	admin.HandleFunc("/shipping/methods", handlers.ListShippingMethods).Methods("GET")
+	admin.HandleFunc("/orders/{id:[0-9]+}/shipments", handlers.CreateShipment).Methods("POST")
+	admin.HandleFunc("/webhooks", handlers.CreateWebhook).Methods("POST")
+	admin.HandleFunc("/webhooks", handlers.ListWebhooks).Methods("GET")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}", handlers.UpdateWebhook).Methods("PUT")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}", handlers.DeleteWebhook).Methods("DELETE")
+	admin.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", handlers.ListWebhookDeliveries).Methods("GET")
+	admin.HandleFunc("/webhooks/deliveries/{id:[0-9]+}", handlers.GetWebhookDelivery).Methods("GET")
+	admin.HandleFunc("/webhooks/deliveries/{id:[0-9]+}/redeliver", handlers.RedeliverWebhook).Methods("POST")
+	admin.HandleFunc("/jobs", handlers.ListJobs).Methods("GET")
+	admin.HandleFunc("/jobs/{id:[0-9]+}/retry", handlers.RetryJob).Methods("POST")
 
 	// Payment routes
-	api.HandleFunc("/create-payment-intent", handlers.CreatePaymentIntent).Methods("POST")
-	api.HandleFunc("/webhook", handlers.HandleWebhook).Methods("POST")
+	api.Handle("/create-payment-intent", middleware.Idempotent(http.HandlerFunc(handlers.CreatePaymentIntent))).Methods("POST")
 
 	return router
 }
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/models"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrAddressNotFound   = errors.New("address not found")
+	ErrNoDefaultShipping = errors.New("no shipping address selected and no default shipping address set")
+)
+
+const addressColumns = "id, user_id, full_name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing, created_at, updated_at"
+
+func scanAddress(row interface{ Scan(...interface{}) error }, a *models.Address) error {
+	return row.Scan(&a.ID, &a.UserID, &a.FullName, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode,
+		&a.Country, &a.Phone, &a.IsDefaultShipping, &a.IsDefaultBilling, &a.CreatedAt, &a.UpdatedAt)
+}
+
+func ListAddresses(ctx context.Context, userID int) ([]models.Address, error) {
+	query := "SELECT " + addressColumns + " FROM addresses WHERE user_id=$1 ORDER BY is_default_shipping DESC, id"
+	rows, err := database.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []models.Address{}
+	for rows.Next() {
+		var a models.Address
+		if err := scanAddress(rows, &a); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
+}
+
+func GetAddress(ctx context.Context, q database.Querier, userID, addressID int) (*models.Address, error) {
+	var a models.Address
+	query := "SELECT " + addressColumns + " FROM addresses WHERE user_id=$1 AND id=$2"
+	err := scanAddress(q.QueryRowContext(ctx, query, userID, addressID), &a)
+	if err == sql.ErrNoRows {
+		return nil, ErrAddressNotFound
+	}
+	return &a, err
+}
+
+// DefaultShippingAddress returns the user's default shipping address
+func DefaultShippingAddress(ctx context.Context, q database.Querier, userID int) (*models.Address, error) {
+	var a models.Address
+	query := "SELECT " + addressColumns + " FROM addresses WHERE user_id=$1 AND is_default_shipping"
+	err := scanAddress(q.QueryRowContext(ctx, query, userID), &a)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoDefaultShipping
+	}
+	return &a, err
+}
+
+// SaveAddress inserts the address when a.ID is zero and updates it otherwise.
+// Marking it as a default clears that flag on the user's other addresses in the
+// same transaction. A user's first address becomes both defaults.
+func SaveAddress(ctx context.Context, a *models.Address) error {
+	a.Country = strings.ToUpper(a.Country)
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.ID == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM addresses WHERE user_id=$1", a.UserID).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			a.IsDefaultShipping, a.IsDefaultBilling = true, true
+		}
+	}
+
+	if a.IsDefaultShipping {
+		if _, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_shipping=FALSE WHERE user_id=$1 AND id<>$2", a.UserID, a.ID); err != nil {
+			return err
+		}
+	}
+	if a.IsDefaultBilling {
+		if _, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_billing=FALSE WHERE user_id=$1 AND id<>$2", a.UserID, a.ID); err != nil {
+			return err
+		}
+	}
+
+	if a.ID == 0 {
+		query := `INSERT INTO addresses (user_id, full_name, line1, line2, city, region, postal_code, country, phone, is_default_shipping, is_default_billing)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING ` + addressColumns
+		err = scanAddress(tx.QueryRowContext(ctx, query, a.UserID, a.FullName, a.Line1, a.Line2, a.City, a.Region,
+			a.PostalCode, a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling), a)
+	} else {
+		query := `UPDATE addresses SET full_name=$1, line1=$2, line2=$3, city=$4, region=$5, postal_code=$6, country=$7, phone=$8,
+			is_default_shipping=$9, is_default_billing=$10, updated_at=NOW()
+			WHERE id=$11 AND user_id=$12 RETURNING ` + addressColumns
+		err = scanAddress(tx.QueryRowContext(ctx, query, a.FullName, a.Line1, a.Line2, a.City, a.Region, a.PostalCode,
+			a.Country, a.Phone, a.IsDefaultShipping, a.IsDefaultBilling, a.ID, a.UserID), a)
+	}
+	if err == sql.ErrNoRows {
+		return ErrAddressNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAddress removes an address; orders keep their own snapshot. Deleting a
+// default passes that flag to the user's oldest remaining address, so checkout
+// still has a default to fall back to.
+func DeleteAddress(ctx context.Context, userID, addressID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var wasShipping, wasBilling bool
+	err = tx.QueryRowContext(ctx, "DELETE FROM addresses WHERE user_id=$1 AND id=$2 RETURNING is_default_shipping, is_default_billing",
+		userID, addressID).Scan(&wasShipping, &wasBilling)
+	if err == sql.ErrNoRows {
+		return ErrAddressNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if wasShipping || wasBilling {
+		query := `UPDATE addresses SET is_default_shipping = is_default_shipping OR $2, is_default_billing = is_default_billing OR $3,
+			updated_at=NOW() WHERE id = (SELECT MIN(id) FROM addresses WHERE user_id=$1)`
+		if _, err := tx.ExecContext(ctx, query, userID, wasShipping, wasBilling); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ShippingAddressForOrder resolves the address chosen at checkout, falling back
+// to the user's default shipping address
+func ShippingAddressForOrder(ctx context.Context, q database.Querier, userID int, addressID *int) (*models.Address, error) {
+	if addressID != nil {
+		return GetAddress(ctx, q, userID, *addressID)
+	}
+	return DefaultShippingAddress(ctx, q, userID)
+}
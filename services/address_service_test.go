@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func addressRow(id int64, shipping, billing bool) dbtest.Result {
+	now := time.Now()
+	return dbtest.Row(id, int64(7), "Ada Lovelace", "1 Main St", "", "London", "", "N1", "GB", "",
+		shipping, billing, now, now)
+}
+
+func TestSaveAddressDefaults(t *testing.T) {
+	tests := []struct {
+		name                        string
+		existing                    int64
+		shipping, billing           bool
+		wantShipping, wantBilling   bool
+		wantClearShip, wantClearBil bool
+	}{
+		{"first address becomes both defaults", 0, false, false, true, true, true, true},
+		{"later address is not a default", 2, false, false, false, false, false, false},
+		{"new default shipping clears the old one", 2, true, false, true, false, true, false},
+		{"new default billing clears the old one", 2, false, true, false, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT COUNT(*) FROM addresses"):
+					return dbtest.Row(tt.existing)
+				case strings.Contains(query, "INSERT INTO addresses"):
+					return addressRow(9, args[9].(bool), args[10].(bool))
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			a := &models.Address{UserID: 7, FullName: "Ada Lovelace", Line1: "1 Main St", City: "London",
+				PostalCode: "N1", Country: "gb", IsDefaultShipping: tt.shipping, IsDefaultBilling: tt.billing}
+			if err := SaveAddress(context.Background(), a); err != nil {
+				t.Fatal(err)
+			}
+			if a.ID != 9 || a.IsDefaultShipping != tt.wantShipping || a.IsDefaultBilling != tt.wantBilling {
+				t.Errorf("saved %+v, want id 9, default shipping %v, billing %v", a, tt.wantShipping, tt.wantBilling)
+			}
+			insert := db.Ran("INSERT INTO addresses")
+			if len(insert) != 1 || insert[0].Args[7] != "GB" {
+				t.Errorf("insert = %+v, want one insert with the country upper-cased", insert)
+			}
+			if got := len(db.Ran("SET is_default_shipping=FALSE")) == 1; got != tt.wantClearShip {
+				t.Errorf("cleared other default shipping addresses = %v, want %v", got, tt.wantClearShip)
+			}
+			if got := len(db.Ran("SET is_default_billing=FALSE")) == 1; got != tt.wantClearBil {
+				t.Errorf("cleared other default billing addresses = %v, want %v", got, tt.wantClearBil)
+			}
+			if len(db.Ran("COMMIT")) != 1 {
+				t.Error("transaction not committed")
+			}
+		})
+	}
+}
+
+func TestDeleteAddressReassignsDefaults(t *testing.T) {
+	tests := []struct {
+		name              string
+		shipping, billing bool
+	}{
+		{"default shipping", true, false},
+		{"default billing", false, true},
+		{"both defaults", true, true},
+		{"not a default", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				if strings.Contains(query, "DELETE FROM addresses") {
+					return dbtest.Row(tt.shipping, tt.billing)
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			if err := DeleteAddress(context.Background(), 7, 4); err != nil {
+				t.Fatal(err)
+			}
+
+			promoted := db.Ran("SELECT MIN(id) FROM addresses")
+			if !tt.shipping && !tt.billing {
+				if len(promoted) != 0 {
+					t.Errorf("promoted an address after deleting a non-default one: %+v", promoted)
+				}
+				return
+			}
+			if len(promoted) != 1 {
+				t.Fatalf("promote statements = %+v, want one", promoted)
+			}
+			want := []driver.Value{int64(7), tt.shipping, tt.billing}
+			if !reflect.DeepEqual(promoted[0].Args, want) {
+				t.Errorf("promote args = %v, want %v", promoted[0].Args, want)
+			}
+			if len(db.Ran("COMMIT")) != 1 {
+				t.Error("transaction not committed")
+			}
+		})
+	}
+}
+
+func TestDeleteAddressNotFound(t *testing.T) {
+	db := dbtest.New(t, nil)
+
+	if err := DeleteAddress(context.Background(), 7, 4); !errors.Is(err, ErrAddressNotFound) {
+		t.Fatalf("DeleteAddress = %v, want ErrAddressNotFound", err)
+	}
+	if len(db.Ran("UPDATE addresses")) != 0 || len(db.Ran("COMMIT")) != 0 {
+		t.Errorf("calls = %+v, want nothing after the missing delete", db.Calls())
+	}
+}
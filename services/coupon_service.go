@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponExhausted     = errors.New("coupon usage limit reached")
+	ErrCouponUserLimit     = errors.New("you have already used this coupon the maximum number of times")
+	ErrCouponMinimum       = errors.New("order does not meet the coupon's minimum value")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the cart")
+)
+
+// IsCouponError reports whether err is a customer-facing coupon rejection
+func IsCouponError(err error) bool {
+	for _, target := range []error{ErrCouponNotFound, ErrCouponExpired, ErrCouponExhausted,
+		ErrCouponUserLimit, ErrCouponMinimum, ErrCouponNotApplicable} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+const couponColumns = "id, code, type, value, min_order_value, expires_at, max_uses, max_uses_per_user, used_count, product_id, category, created_at"
+
+func scanCoupon(row interface{ Scan(...interface{}) error }, c *models.Coupon) error {
+	return row.Scan(&c.ID, &c.Code, &c.Type, &c.Value, &c.MinOrderValue, &c.ExpiresAt, &c.MaxUses,
+		&c.MaxUsesPerUser, &c.UsedCount, &c.ProductID, &c.Category, &c.CreatedAt)
+}
+
+// NormalizeCouponCode makes codes case-insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func CreateCoupon(ctx context.Context, c *models.Coupon) error {
+	query := `INSERT INTO coupons (code, type, value, min_order_value, expires_at, max_uses, max_uses_per_user, product_id, category)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, used_count, created_at`
+	return database.DB.QueryRowContext(ctx, query, c.Code, c.Type, c.Value, c.MinOrderValue, c.ExpiresAt,
+		c.MaxUses, c.MaxUsesPerUser, c.ProductID, c.Category).Scan(&c.ID, &c.UsedCount, &c.CreatedAt)
+}
+
+func ListCoupons(ctx context.Context) ([]models.Coupon, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT "+couponColumns+" FROM coupons ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []models.Coupon{}
+	for rows.Next() {
+		var c models.Coupon
+		if err := scanCoupon(rows, &c); err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+	return coupons, rows.Err()
+}
+
+func FindCouponByCode(ctx context.Context, q database.Querier, code string) (*models.Coupon, error) {
+	var c models.Coupon
+	err := scanCoupon(q.QueryRowContext(ctx, "SELECT "+couponColumns+" FROM coupons WHERE code=$1", NormalizeCouponCode(code)), &c)
+	if err == sql.ErrNoRows {
+		return nil, ErrCouponNotFound
+	}
+	return &c, err
+}
+
+// AppliedCoupon returns the coupon the user attached to their cart, or nil
+func AppliedCoupon(ctx context.Context, q database.Querier, userID int) (*models.Coupon, error) {
+	var c models.Coupon
+	query := "SELECT " + prefixColumns("c.", couponColumns) + " FROM cart_coupons cc JOIN coupons c ON c.id = cc.coupon_id WHERE cc.user_id=$1"
+	err := scanCoupon(q.QueryRowContext(ctx, query, userID), &c)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &c, err
+}
+
+func AttachCouponToCart(ctx context.Context, userID, couponID int) error {
+	query := `INSERT INTO cart_coupons (user_id, coupon_id) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET coupon_id=EXCLUDED.coupon_id, applied_at=NOW()`
+	_, err := database.DB.ExecContext(ctx, query, userID, couponID)
+	return err
+}
+
+// DetachCouponFromCart removes the applied coupon and reports whether there was one
+func DetachCouponFromCart(ctx context.Context, q database.Querier, userID int) (bool, error) {
+	res, err := q.ExecContext(ctx, "DELETE FROM cart_coupons WHERE user_id=$1", userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// CheckCouponEligibility enforces expiry, usage limits, minimum order value and scoping
+func CheckCouponEligibility(ctx context.Context, q database.Querier, c *models.Coupon, userID int, lines []LineItem) error {
+	if c.ExpiresAt != nil && time.Now().After(*c.ExpiresAt) {
+		return ErrCouponExpired
+	}
+	if c.MaxUses != nil && c.UsedCount >= *c.MaxUses {
+		return ErrCouponExhausted
+	}
+	if c.MaxUsesPerUser != nil {
+		var used int
+		err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id=$1 AND user_id=$2", c.ID, userID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used >= *c.MaxUsesPerUser {
+			return ErrCouponUserLimit
+		}
+	}
+	if CartSubtotal(lines) < c.MinOrderValue {
+		return ErrCouponMinimum
+	}
+
+	for _, line := range lines {
+		if couponCovers(c, line) {
+			return nil
+		}
+	}
+	return ErrCouponNotApplicable
+}
+
+// ApplyCouponDiscount sets Discount on every eligible line and returns the total
+// discount. A fixed amount is spread across eligible lines in proportion to their
+// value; the last eligible line absorbs the rounding remainder so lines sum exactly.
+// Free-shipping coupons discount no line; the caller waives shipping instead.
+func ApplyCouponDiscount(c *models.Coupon, lines []LineItem) float64 {
+	var eligible []int
+	var eligibleTotal float64
+	for i := range lines {
+		lines[i].Discount = 0
+		if couponCovers(c, lines[i]) {
+			eligible = append(eligible, i)
+			eligibleTotal += lines[i].Subtotal()
+		}
+	}
+	if len(eligible) == 0 || eligibleTotal == 0 {
+		return 0
+	}
+
+	var target float64
+	switch c.Type {
+	case models.CouponPercentage:
+		target = roundCents(eligibleTotal * c.Value / 100)
+	case models.CouponFixed:
+		target = c.Value
+	default:
+		return 0
+	}
+	if target > eligibleTotal {
+		target = eligibleTotal
+	}
+
+	remaining := target
+	for n, i := range eligible {
+		share := roundCents(target * lines[i].Subtotal() / eligibleTotal)
+		if n == len(eligible)-1 || share > remaining {
+			share = remaining
+		}
+		lines[i].Discount = share
+		remaining = roundCents(remaining - share)
+	}
+	return target
+}
+
+// RedeemCoupon records the use inside the checkout transaction. The guarded
+// increment keeps concurrent checkouts from exceeding max_uses, and it locks the
+// coupon row until commit, so the per-user count taken after it sees every
+// redemption that committed first.
+func RedeemCoupon(ctx context.Context, tx *sql.Tx, c *models.Coupon, userID, orderID int, discount float64) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE coupons SET used_count = used_count + 1 WHERE id=$1 AND (max_uses IS NULL OR used_count < max_uses)", c.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCouponExhausted
+	}
+	if c.MaxUsesPerUser != nil {
+		var used int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id=$1 AND user_id=$2", c.ID, userID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used >= *c.MaxUsesPerUser {
+			return ErrCouponUserLimit
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, discount) VALUES ($1, $2, $3, $4)",
+		c.ID, userID, orderID, discount)
+	return err
+}
+
+// ReleaseCoupon gives back the coupon use of an order that is cancelled or
+// expires, inside the transaction that cancels it, so abandoned orders do not
+// count against max_uses or max_uses_per_user
+func ReleaseCoupon(ctx context.Context, tx *sql.Tx, orderID int) error {
+	query := `WITH released AS (DELETE FROM coupon_redemptions WHERE order_id=$1 RETURNING coupon_id)
+		UPDATE coupons c SET used_count = c.used_count - 1 FROM released WHERE c.id = released.coupon_id`
+	_, err := tx.ExecContext(ctx, query, orderID)
+	return err
+}
+
+func couponCovers(c *models.Coupon, line LineItem) bool {
+	if c.ProductID != nil && *c.ProductID != line.ProductID {
+		return false
+	}
+	if c.Category != nil && !strings.EqualFold(*c.Category, line.Category) {
+		return false
+	}
+	return true
+}
+
+func prefixColumns(prefix, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i := range parts {
+		parts[i] = prefix + parts[i]
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedeemCouponRechecksUserLimitUnderLock(t *testing.T) {
+	tests := []struct {
+		name string
+		used int64
+		want error
+	}{
+		{"under the limit", 1, nil},
+		{"limit reached by a concurrent checkout", 2, ErrCouponUserLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				if strings.Contains(query, "SELECT COUNT(*) FROM coupon_redemptions") {
+					return dbtest.Row(tt.used)
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+			ctx := context.Background()
+			tx, err := database.DB.BeginTx(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			limit := 2
+			coupon := &models.Coupon{ID: 3, MaxUsesPerUser: &limit}
+			if err := RedeemCoupon(ctx, tx, coupon, 7, 40, 5); !errors.Is(err, tt.want) {
+				t.Fatalf("RedeemCoupon = %v, want %v", err, tt.want)
+			}
+
+			var order []string
+			for _, c := range db.Calls() {
+				switch {
+				case strings.Contains(c.Query, "UPDATE coupons"):
+					order = append(order, "lock")
+				case strings.Contains(c.Query, "COUNT(*)"):
+					order = append(order, "count")
+				case strings.Contains(c.Query, "INSERT INTO coupon_redemptions"):
+					order = append(order, "insert")
+				}
+			}
+			want := "lock,count,insert"
+			if tt.want != nil {
+				want = "lock,count"
+			}
+			if got := strings.Join(order, ","); got != want {
+				t.Errorf("statements = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyCouponDiscountSpreadsFixedAmount(t *testing.T) {
+	lines := []LineItem{{ProductID: 1, UnitPrice: 10, Quantity: 1}, {ProductID: 2, UnitPrice: 20, Quantity: 1}}
+	coupon := &models.Coupon{Type: models.CouponFixed, Value: 10}
+
+	if got := ApplyCouponDiscount(coupon, lines); got != 10 {
+		t.Fatalf("discount = %v, want 10", got)
+	}
+	if lines[0].Discount != 3.33 || lines[1].Discount != 6.67 {
+		t.Errorf("line discounts = %v, %v, want 3.33, 6.67", lines[0].Discount, lines[1].Discount)
+	}
+}
+
+func TestCancelledAndExpiredOrdersReleaseTheirCoupon(t *testing.T) {
+	cancel := func(ctx context.Context) error {
+		_, err := CancelOrder(ctx, 40, "cancelled by customer")
+		return err
+	}
+	expire := func(ctx context.Context) error {
+		expired, err := expireOrder(ctx, 40)
+		if err == nil && !expired {
+			err = errors.New("order not expired")
+		}
+		return err
+	}
+	for name, run := range map[string]func(context.Context) error{"cancel": cancel, "expire": expire} {
+		t.Run(name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT status FROM orders"):
+					return dbtest.Row("Not Paid")
+				case strings.Contains(query, "RETURNING "+OrderColumns):
+					return dbtest.Row(int64(40), int64(7), 50.0, 5.0, "SAVE5", nil, 0.0, 0.0, 45.0, "Cancelled", nil, time.Now())
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			if err := run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			released := db.Ran("DELETE FROM coupon_redemptions")
+			if len(released) != 1 || released[0].Args[0] != int64(40) {
+				t.Fatalf("released %v, want order 40's redemption", released)
+			}
+			if !strings.Contains(released[0].Query, "used_count = c.used_count - 1") {
+				t.Errorf("release %q does not give the use back", released[0].Query)
+			}
+			// the release must commit or roll back with the cancellation
+			calls := db.Calls()
+			if calls[0].Query != "BEGIN" || calls[len(calls)-1].Query != "COMMIT" {
+				t.Errorf("release ran outside the cancelling transaction: %v", calls)
+			}
+		})
+	}
+}
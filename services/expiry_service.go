@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"e-commerce/database"
+	"e-commerce/events"
+	"time"
+)
+
+const expiryBatchSize = 100
+
+// ExpireUnpaidOrders cancels orders that have sat in "Not Paid" for longer than
+// ttl, releasing their reserved stock and coupon use and marking pending
+// payments as expired.
+// It returns how many orders were expired.
+func ExpireUnpaidOrders(ctx context.Context, ttl time.Duration) (int, error) {
+	expired := 0
+	for {
+		ids, err := staleOrderIDs(ctx, ttl)
+		if err != nil {
+			return expired, err
+		}
+		for _, id := range ids {
+			ok, err := expireOrder(ctx, id)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+		if len(ids) < expiryBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+func staleOrderIDs(ctx context.Context, ttl time.Duration) ([]int, error) {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id FROM orders WHERE status='Not Paid' AND created_at < NOW() - make_interval(secs => $1)
+		ORDER BY created_at LIMIT $2`
+	rows, err := database.DB.QueryContext(dbCtx, query, ttl.Seconds(), expiryBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// expireOrder cancels one order if it is still unpaid. The guarded update locks
+// the row, so a payment webhook racing with expiry either wins or waits and then
+// finds the order cancelled.
+func expireOrder(ctx context.Context, orderID int) (bool, error) {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := database.DB.BeginTx(dbCtx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(dbCtx, "UPDATE orders SET status='Cancelled' WHERE id=$1 AND status='Not Paid'", orderID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := RestockOrder(dbCtx, tx, orderID, "reservation expired"); err != nil {
+		return false, err
+	}
+	if err := ReleaseCoupon(dbCtx, tx, orderID); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(dbCtx, "UPDATE payments SET status='expired' WHERE order_id=$1 AND status='pending'", orderID); err != nil {
+		return false, err
+	}
+	if err := events.RecordStatusChange(dbCtx, tx, orderID, "Not Paid", "Cancelled"); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/config"
+	"e-commerce/database"
+	"time"
+)
+
+var (
+	idempotencyLockTTL   = time.Minute
+	idempotencyRetention = 24 * time.Hour
+)
+
+// ConfigureIdempotency sets how long an unfinished request holds its key and
+// how long a finished response is replayed
+func ConfigureIdempotency(cfg config.IdempotencyConfig) {
+	idempotencyLockTTL = cfg.LockTTL
+	idempotencyRetention = cfg.Retention
+}
+
+// IdempotencyRecord is a previously seen Idempotency-Key. StatusCode is zero
+// while the original request is still being processed.
+type IdempotencyRecord struct {
+	RequestHash  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+}
+
+// ReserveIdempotencyKey claims a key for this request. It returns (nil, nil) when
+// the caller now owns the key, or the existing record when the key was used before.
+// A key whose request never finished within the lock TTL (the process died) or
+// whose response is past the retention window is taken over as if new.
+func ReserveIdempotencyKey(ctx context.Context, userID int, endpoint, key, requestHash string) (*IdempotencyRecord, error) {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	var id int
+	query := `INSERT INTO idempotency_keys (user_id, endpoint, key, request_hash) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, endpoint, key) DO UPDATE
+		SET request_hash=EXCLUDED.request_hash, status_code=NULL, content_type=NULL, response_body=NULL,
+			created_at=NOW(), completed_at=NULL
+		WHERE (idempotency_keys.completed_at IS NULL AND idempotency_keys.created_at < NOW() - make_interval(secs => $5))
+			OR idempotency_keys.completed_at < NOW() - make_interval(secs => $6)
+		RETURNING id`
+	err := database.DB.QueryRowContext(dbCtx, query, userID, endpoint, key, requestHash,
+		idempotencyLockTTL.Seconds(), idempotencyRetention.Seconds()).Scan(&id)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var record IdempotencyRecord
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	query = "SELECT request_hash, status_code, content_type, response_body FROM idempotency_keys WHERE user_id=$1 AND endpoint=$2 AND key=$3"
+	err = database.DB.QueryRowContext(dbCtx, query, userID, endpoint, key).
+		Scan(&record.RequestHash, &statusCode, &contentType, &record.ResponseBody)
+	if err != nil {
+		return nil, err
+	}
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	return &record, nil
+}
+
+// CompleteIdempotencyKey stores the response so retries replay it
+func CompleteIdempotencyKey(ctx context.Context, userID int, endpoint, key string, statusCode int, contentType string, body []byte) error {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE idempotency_keys SET status_code=$1, content_type=$2, response_body=$3, completed_at=NOW()
+		WHERE user_id=$4 AND endpoint=$5 AND key=$6`
+	_, err := database.DB.ExecContext(dbCtx, query, statusCode, contentType, body, userID, endpoint, key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a key whose request failed server-side, so the client may retry it
+func ReleaseIdempotencyKey(ctx context.Context, userID int, endpoint, key string) error {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	query := "DELETE FROM idempotency_keys WHERE user_id=$1 AND endpoint=$2 AND key=$3"
+	_, err := database.DB.ExecContext(dbCtx, query, userID, endpoint, key)
+	return err
+}
+
+// PruneIdempotencyKeys deletes responses past the retention window and keys
+// abandoned by requests that never finished
+func PruneIdempotencyKeys(ctx context.Context) (int64, error) {
+	query := `DELETE FROM idempotency_keys
+		WHERE completed_at < NOW() - make_interval(secs => $1)
+			OR (completed_at IS NULL AND created_at < NOW() - make_interval(secs => $2))`
+	res, err := database.DB.ExecContext(ctx, query, idempotencyRetention.Seconds(), idempotencyLockTTL.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
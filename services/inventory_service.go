@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/config"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/logging"
+	"e-commerce/metrics"
+	"e-commerce/models"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrProductNotFound   = errors.New("product not found")
+)
+
+var defaultLowStockThreshold = 5
+
+// ConfigureInventory sets the store-wide low-stock threshold
+func ConfigureInventory(cfg config.InventoryConfig) {
+	defaultLowStockThreshold = cfg.LowStockThreshold
+}
+
+// LowStockEvent is raised when a movement takes a product's balance from above
+// its threshold to at or below it
+type LowStockEvent struct {
+	ProductID int
+	Name      string
+	Stock     int
+	Threshold int
+}
+
+// LowStockNotifier receives low-stock events once the movement that caused them
+// has been committed
+type LowStockNotifier interface {
+	NotifyLowStock(ctx context.Context, event LowStockEvent)
+}
+
+// LowStock is the notifier used for every movement. The default logs a warning
+// and counts the event; other integrations can be installed in its place.
+var LowStock LowStockNotifier = LogLowStockNotifier{}
+
+type LogLowStockNotifier struct{}
+
+func (LogLowStockNotifier) NotifyLowStock(ctx context.Context, e LowStockEvent) {
+	metrics.LowStockEvents.Inc()
+	logging.FromContext(ctx).Warn("product stock is low",
+		"product_id", e.ProductID, "product", e.Name, "stock", e.Stock, "threshold", e.Threshold)
+}
+
+// StockAlerts collects the low-stock events raised inside a transaction so they
+// are only sent after it commits
+type StockAlerts []LowStockEvent
+
+func (a StockAlerts) Send(ctx context.Context) {
+	for _, event := range a {
+		LowStock.NotifyLowStock(ctx, event)
+	}
+}
+
+const movementColumns = "id, product_id, kind, quantity, balance, order_id, note, created_by, created_at"
+
+// RecordMovement appends m to the ledger and applies it to the product's stock
+// balance. A movement that would take the balance below zero fails with
+// ErrInsufficientStock, so concurrent checkouts cannot oversell. A balance that
+// rises from zero records a product.back_in_stock event.
+func RecordMovement(ctx context.Context, tx *sql.Tx, m *models.InventoryMovement, alerts *StockAlerts) error {
+	var before, threshold int
+	var name string
+	query := `UPDATE products SET stock = stock + $1 WHERE id=$2 AND stock + $1 >= 0
+		RETURNING stock - $1, stock, COALESCE(low_stock_threshold, $3), name`
+	err := tx.QueryRowContext(ctx, query, m.Quantity, m.ProductID, defaultLowStockThreshold).Scan(&before, &m.Balance, &threshold, &name)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM products WHERE id=$1)", m.ProductID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrProductNotFound
+		}
+		return fmt.Errorf("%w for product %d", ErrInsufficientStock, m.ProductID)
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO inventory_movements (product_id, kind, quantity, balance, order_id, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, m.ProductID, m.Kind, m.Quantity, m.Balance, m.OrderID, m.Note, m.CreatedBy).
+		Scan(&m.ID, &m.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if before == 0 && m.Balance > 0 {
+		change := events.StockChange{ProductID: m.ProductID, Stock: m.Balance}
+		if err := events.Record(ctx, tx, events.ProductBackInStock, "product", m.ProductID, change); err != nil {
+			return err
+		}
+	}
+	if alerts != nil && before > threshold && m.Balance <= threshold {
+		*alerts = append(*alerts, LowStockEvent{ProductID: m.ProductID, Name: name, Stock: m.Balance, Threshold: threshold})
+	}
+	return nil
+}
+
+// AdjustStock records a manual movement by an admin in its own transaction
+func AdjustStock(ctx context.Context, m *models.InventoryMovement) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var alerts StockAlerts
+	if err := RecordMovement(ctx, tx, m, &alerts); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	alerts.Send(ctx)
+	return nil
+}
+
+// StockMovements returns a product's ledger, newest first
+func StockMovements(ctx context.Context, productID, limit int) ([]models.InventoryMovement, error) {
+	query := "SELECT " + movementColumns + " FROM inventory_movements WHERE product_id=$1 ORDER BY id DESC LIMIT $2"
+	rows, err := database.DB.QueryContext(ctx, query, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.InventoryMovement{}
+	for rows.Next() {
+		var m models.InventoryMovement
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.Kind, &m.Quantity, &m.Balance, &m.OrderID, &m.Note, &m.CreatedBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// LowStockProducts lists active products at or below their threshold, lowest stock first
+func LowStockProducts(ctx context.Context) ([]models.Products, error) {
+	query := `SELECT id, name, stock, low_stock_threshold FROM products
+		WHERE archived_at IS NULL AND stock <= COALESCE(low_stock_threshold, $1) ORDER BY stock, id`
+	rows, err := database.DB.QueryContext(ctx, query, defaultLowStockThreshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Products{}
+	for rows.Next() {
+		var p models.Products
+		if err := rows.Scan(&p.ID, &p.Name, &p.Stock, &p.LowStockThreshold); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// ReserveStock holds stock for each line of a new order until it is paid or cancelled
+func ReserveStock(ctx context.Context, tx *sql.Tx, orderID int, lines []LineItem, alerts *StockAlerts) error {
+	for _, line := range lines {
+		m := models.InventoryMovement{ProductID: line.ProductID, Kind: models.MovementReservation, Quantity: -line.Quantity, OrderID: &orderID}
+		if err := RecordMovement(ctx, tx, &m, alerts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderStock sums an order's movements of one kind per product, negated so units
+// taken from stock come back positive
+func orderStock(ctx context.Context, tx *sql.Tx, orderID int, kinds ...string) (map[int]int, error) {
+	query := `SELECT product_id, -SUM(quantity) FROM inventory_movements
+		WHERE order_id=$1 AND kind = ANY($2) GROUP BY product_id`
+	rows, err := tx.QueryContext(ctx, query, orderID, kinds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := map[int]int{}
+	for rows.Next() {
+		var productID, qty int
+		if err := rows.Scan(&productID, &qty); err != nil {
+			return nil, err
+		}
+		if qty > 0 {
+			held[productID] = qty
+		}
+	}
+	return held, rows.Err()
+}
+
+// CompleteSale turns an order's reservations into sales once it is paid. The
+// balance is unchanged, so no low-stock events are raised.
+func CompleteSale(ctx context.Context, tx *sql.Tx, orderID int) error {
+	held, err := orderStock(ctx, tx, orderID, models.MovementReservation)
+	if err != nil {
+		return err
+	}
+	for productID, qty := range held {
+		release := models.InventoryMovement{ProductID: productID, Kind: models.MovementReservation, Quantity: qty, OrderID: &orderID, Note: "paid"}
+		if err := RecordMovement(ctx, tx, &release, nil); err != nil {
+			return err
+		}
+		sale := models.InventoryMovement{ProductID: productID, Kind: models.MovementSale, Quantity: -qty, OrderID: &orderID}
+		if err := RecordMovement(ctx, tx, &sale, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestockOrder puts a cancelled order's units back: outstanding reservations are
+// released and units already sold are recorded as returns
+func RestockOrder(ctx context.Context, tx *sql.Tx, orderID int, note string) error {
+	held, err := orderStock(ctx, tx, orderID, models.MovementReservation)
+	if err != nil {
+		return err
+	}
+	for productID, qty := range held {
+		m := models.InventoryMovement{ProductID: productID, Kind: models.MovementReservation, Quantity: qty, OrderID: &orderID, Note: note}
+		if err := RecordMovement(ctx, tx, &m, nil); err != nil {
+			return err
+		}
+	}
+
+	sold, err := orderStock(ctx, tx, orderID, models.MovementSale, models.MovementReturn)
+	if err != nil {
+		return err
+	}
+	for productID, qty := range sold {
+		m := models.InventoryMovement{ProductID: productID, Kind: models.MovementReturn, Quantity: qty, OrderID: &orderID, Note: note}
+		if err := RecordMovement(ctx, tx, &m, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/jobs"
+	"e-commerce/logging"
+	"e-commerce/models"
+	"e-commerce/notifications"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// SendNotificationJob is the job kind that renders and sends one email
+const SendNotificationJob = "notifications.send"
+
+var (
+	mailer    notifications.Mailer
+	storeName = "E-Commerce"
+)
+
+// ConfigureNotifications sets the mailer and the store name shown in emails
+func ConfigureNotifications(m notifications.Mailer, name string) {
+	mailer = m
+	storeName = name
+}
+
+// NotificationPreferences returns a user's locale and opted-out kinds
+func NotificationPreferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	prefs := models.NotificationPreferences{OptOuts: []string{}}
+	if err := database.DB.QueryRowContext(ctx, "SELECT locale FROM users WHERE id=$1", userID).Scan(&prefs.Locale); err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT kind FROM notification_opt_outs WHERE user_id=$1 ORDER BY kind", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		prefs.OptOuts = append(prefs.OptOuts, kind)
+	}
+	return &prefs, rows.Err()
+}
+
+// SetNotificationPreferences replaces a user's locale and opt-outs
+func SetNotificationPreferences(ctx context.Context, userID int, prefs models.NotificationPreferences) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET locale=$1 WHERE id=$2", prefs.Locale, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notification_opt_outs WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	for _, kind := range prefs.OptOuts {
+		query := "INSERT INTO notification_opt_outs (user_id, kind) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+		if _, err := tx.ExecContext(ctx, query, userID, kind); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// notificationKind maps a domain event to the email it triggers, if any
+func notificationKind(e events.Event) (string, int, error) {
+	switch e.Type {
+	case events.OrderCreated:
+		orderID, err := strconv.Atoi(e.AggregateID)
+		return notifications.OrderConfirmation, orderID, err
+	case events.OrderStatusChanged:
+		var change events.StatusChange
+		if err := json.Unmarshal(e.Data, &change); err != nil {
+			return "", 0, err
+		}
+		if change.To == "Shipped" {
+			return notifications.OrderShipped, change.OrderID, nil
+		}
+	case events.PaymentFailed:
+		orderID, err := strconv.Atoi(e.AggregateID)
+		return notifications.PaymentFailed, orderID, err
+	}
+	return "", 0, nil
+}
+
+// NotificationSink turns domain events into queued emails. Like WebhookSink it
+// only records each notification and enqueues a job, and rows are unique per
+// event, kind and recipient so a relayed duplicate sends nothing twice.
+type NotificationSink struct{}
+
+func (NotificationSink) Name() string { return "notifications" }
+
+func (NotificationSink) Publish(ctx context.Context, e events.Event) error {
+	if e.Type == events.ProductUpdated || e.Type == events.ProductBackInStock {
+		return notifyWishlists(ctx, e)
+	}
+
+	kind, orderID, err := notificationKind(e)
+	if err != nil {
+		return fmt.Errorf("decoding %s event: %w", e.Type, err)
+	}
+	if kind == "" {
+		return nil
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO notifications (user_id, order_id, kind, event_id)
+		SELECT user_id, id, $2, $3 FROM orders WHERE id=$1
+		ON CONFLICT (event_id, kind, user_id) DO NOTHING
+		RETURNING id`
+	if err := queueNotifications(ctx, tx, query, orderID, kind, e.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notifyWishlists emails everyone with the product on a wishlist when it comes
+// back in stock, or when its price falls below the price they were last told
+// about. That price then follows the product's, up as well as down, so a drop
+// after a rise notifies again.
+func notifyWishlists(ctx context.Context, e events.Event) error {
+	productID, err := strconv.Atoi(e.AggregateID)
+	if err != nil {
+		return fmt.Errorf("decoding %s event: %w", e.Type, err)
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO notifications (user_id, product_id, kind, event_id)
+		SELECT DISTINCT w.user_id, i.product_id, $2, $3
+		FROM wishlist_items i JOIN wishlists w ON w.id = i.wishlist_id JOIN products p ON p.id = i.product_id
+		WHERE i.product_id=$1 AND p.archived_at IS NULL`
+	if e.Type == events.ProductBackInStock {
+		query += " ON CONFLICT (event_id, kind, user_id) DO NOTHING RETURNING id"
+		err = queueNotifications(ctx, tx, query, productID, notifications.BackInStock, e.ID)
+	} else {
+		var product models.Products
+		if err := json.Unmarshal(e.Data, &product); err != nil {
+			return fmt.Errorf("decoding %s event: %w", e.Type, err)
+		}
+		// events recorded before scheduled pricing only carry the list price
+		price := product.EffectivePrice
+		if price == 0 {
+			price = product.Price
+		}
+		query += " AND i.notified_price > $4 ON CONFLICT (event_id, kind, user_id) DO NOTHING RETURNING id"
+		err = queueNotifications(ctx, tx, query, productID, notifications.PriceDrop, e.ID, price)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE wishlist_items SET notified_price=$2 WHERE product_id=$1 AND notified_price <> $2",
+				productID, price)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queueNotifications runs an INSERT ... RETURNING id into notifications and
+// enqueues a send job for every row it created
+func queueNotifications(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := jobs.Enqueue(ctx, tx, jobs.NewJob{
+			Kind:      SendNotificationJob,
+			Payload:   notificationJob{NotificationID: id},
+			UniqueKey: fmt.Sprintf("notification:%d", id),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type notificationJob struct {
+	NotificationID int64 `json:"notification_id"`
+}
+
+// SendNotification is the job handler for SendNotificationJob. Opt-outs are
+// checked when the email is sent, so opting out also stops queued emails.
+func SendNotification(ctx context.Context, raw json.RawMessage) error {
+	var job notificationJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return err
+	}
+
+	var kind, status, email, locale string
+	var userID int
+	var orderID, productID *int
+	var optedOut bool
+	query := `SELECT n.kind, n.status, n.user_id, n.order_id, n.product_id, u.email, u.locale,
+			EXISTS (SELECT 1 FROM notification_opt_outs o WHERE o.user_id = n.user_id AND o.kind = n.kind)
+		FROM notifications n JOIN users u ON u.id = n.user_id
+		WHERE n.id=$1`
+	err := database.DB.QueryRowContext(ctx, query, job.NotificationID).Scan(&kind, &status, &userID, &orderID, &productID, &email, &locale, &optedOut)
+	if err == sql.ErrNoRows {
+		return nil // the user or order was deleted
+	}
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return nil
+	}
+	if optedOut {
+		_, err := database.DB.ExecContext(ctx, "UPDATE notifications SET status='skipped' WHERE id=$1", job.NotificationID)
+		return err
+	}
+
+	data, err := notificationData(ctx, userID, orderID, productID)
+	if err != nil {
+		return err
+	}
+	msg, err := notifications.Render(kind, locale, *data)
+	if err != nil {
+		return err
+	}
+	msg.To = email
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		database.DB.ExecContext(ctx, "UPDATE notifications SET error=$2 WHERE id=$1", job.NotificationID, err.Error())
+		return err
+	}
+
+	// a failure here resends the email on retry; that beats losing it
+	_, err = database.DB.ExecContext(ctx, "UPDATE notifications SET status='sent', error=NULL, sent_at=NOW() WHERE id=$1", job.NotificationID)
+	if err == nil {
+		logging.FromContext(ctx).Info("Sent notification", "notification_id", job.NotificationID, "kind", kind)
+	}
+	return err
+}
+
+// notificationData loads what the templates need: for order emails the order,
+// its lines with product names and its shipments; for wishlist emails the product
+func notificationData(ctx context.Context, userID int, orderID, productID *int) (*notifications.Data, error) {
+	data := notifications.Data{StoreName: storeName}
+	if err := database.DB.QueryRowContext(ctx, "SELECT username FROM users WHERE id=$1", userID).Scan(&data.Username); err != nil {
+		return nil, err
+	}
+
+	if productID != nil {
+		query := "SELECT p.id, p.name, " + EffectivePrice + ", p.stock FROM products p " + SaleJoin + " WHERE p.id=$1"
+		err := database.DB.QueryRowContext(ctx, query, *productID).Scan(&data.Product.ID, &data.Product.Name, &data.Product.Price, &data.Product.Stock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if orderID == nil {
+		return &data, nil
+	}
+
+	query := "SELECT " + OrderColumns + " FROM orders WHERE id=$1"
+	if err := ScanOrder(database.DB.QueryRowContext(ctx, query, *orderID), &data.Order); err != nil {
+		return nil, err
+	}
+
+	items, err := OrderItems(ctx, database.DB, *orderID)
+	if err != nil {
+		return nil, err
+	}
+	names, err := productNames(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		data.Items = append(data.Items, notifications.Item{
+			Name:      names[item.ProductID],
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			LineTotal: item.LineTotal,
+		})
+	}
+
+	if data.Shipments, err = OrderShipments(ctx, database.DB, *orderID); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// productNames resolves the names of the products on an order, archived ones
+// included, keeping a placeholder for any that are missing
+func productNames(ctx context.Context, items []models.OrderItem) (map[int]string, error) {
+	names := make(map[int]string, len(items))
+	var ids []int
+	for _, item := range items {
+		names[item.ProductID] = fmt.Sprintf("Product #%d", item.ProductID)
+		if !slices.Contains(ids, item.ProductID) {
+			ids = append(ids, item.ProductID)
+		}
+	}
+
+	rows, err := database.DB.QueryContext(ctx, "SELECT id, name FROM products WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"e-commerce/database/dbtest"
+	"e-commerce/events"
+	"strings"
+	"testing"
+)
+
+func TestWishlistNotifiedPriceFollowsRises(t *testing.T) {
+	db := dbtest.New(t, nil)
+	e := events.Event{ID: 12, Type: events.ProductUpdated, AggregateID: "4", Data: []byte(`{"price": 100, "effective_price": 100}`)}
+	if err := notifyWishlists(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := db.Ran("UPDATE wishlist_items SET notified_price")
+	if len(updates) != 1 {
+		t.Fatalf("ran %d updates, want 1", len(updates))
+	}
+	// a rise from 80 to 100 must raise the price, so a later drop to 90 alerts
+	if !strings.Contains(updates[0].Query, "notified_price <> $2") || updates[0].Args[1] != 100.0 {
+		t.Errorf("update %q with %v only lowers the notified price", updates[0].Query, updates[0].Args)
+	}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+var (
+	ErrCartEmpty           = errors.New("cart is empty")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrOrderNotCancellable = errors.New("order cannot be cancelled")
+	// ErrOrderCancelled means a cancelled order was asked to change status; its
+	// stock has been put back, so it cannot be revived
+	ErrOrderCancelled = errors.New("a cancelled order cannot change status")
+)
+
+// paidStatuses are the statuses of an order that has been paid for; moving an
+// order into one turns any stock it still holds into sales
+var paidStatuses = []string{"Paid", "Partially Shipped", "Shipped", "Delivered"}
+
+// OrderColumns lists the orders columns read by ScanOrder, in order
+const OrderColumns = "id, user_id, subtotal, discount, coupon_code, shipping_method_id, shipping_cost, tax, total, status, shipping_address, created_at"
+
+func ScanOrder(row interface{ Scan(...interface{}) error }, o *models.Orders) error {
+	var shippingAddress []byte
+	err := row.Scan(&o.ID, &o.UserID, &o.Subtotal, &o.Discount, &o.CouponCode, &o.ShippingMethodID, &o.ShippingCost, &o.Tax, &o.Total, &o.Status, &shippingAddress, &o.CreatedAt)
+	if err != nil || shippingAddress == nil {
+		return err
+	}
+	o.ShippingAddress = &models.AddressSnapshot{}
+	return json.Unmarshal(shippingAddress, o.ShippingAddress)
+}
+
+// LineItem is one priced cart line during checkout
+type LineItem struct {
+	ProductID int
+	Category  string
+	TaxClass  string
+	Weight    float64
+	Quantity  int
+	UnitPrice float64
+	Discount  float64
+	Tax       float64
+}
+
+func (l LineItem) Subtotal() float64 {
+	return roundCents(l.UnitPrice * float64(l.Quantity))
+}
+
+// Total is the line amount after discount, before tax
+func (l LineItem) Total() float64 {
+	return roundCents(l.Subtotal() - l.Discount)
+}
+
+// CartSubtotal sums the lines before any discount
+func CartSubtotal(lines []LineItem) float64 {
+	var total float64
+	for _, line := range lines {
+		total += line.Subtotal()
+	}
+	return roundCents(total)
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// CartLines prices the user's cart at each product's effective price, with a
+// single join instead of one lookup per item. Archived products are skipped;
+// archiving also removes them from carts.
+func CartLines(ctx context.Context, q database.Querier, userID int) ([]LineItem, error) {
+	query := `SELECT c.product_id, c.quantity, ` + EffectivePrice + `, p.category, p.tax_class, p.weight
+		FROM cart c JOIN products p ON p.id = c.product_id ` + SaleJoin + `
+		WHERE c.user_id=$1 AND p.archived_at IS NULL ORDER BY c.id`
+	rows, err := q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []LineItem
+	for rows.Next() {
+		var line LineItem
+		if err := rows.Scan(&line.ProductID, &line.Quantity, &line.UnitPrice, &line.Category, &line.TaxClass, &line.Weight); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// PlaceOrder turns the user's cart into an order in one transaction: it prices the
+// lines, applies the cart's coupon, prices shipping, taxes the lines for the shipping
+// address, writes the order with a snapshot of that address and its items, reserves
+// their stock, records the redemption and empties the cart. A nil AddressID selects the default shipping
+// address and a nil ShippingMethodID the cheapest available method.
+func PlaceOrder(ctx context.Context, userID int, req models.CreateOrderRequest) (*models.Orders, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	lines, err := CartLines(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	address, err := ShippingAddressForOrder(ctx, tx, userID, req.AddressID)
+	if err != nil {
+		return nil, err
+	}
+	shipTo := address.Snapshot()
+	shippingJSON, err := json.Marshal(shipTo)
+	if err != nil {
+		return nil, err
+	}
+
+	coupon, err := AppliedCoupon(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := models.Orders{UserID: userID, Subtotal: CartSubtotal(lines), Status: "Not Paid", ShippingAddress: &shipTo}
+	if coupon != nil {
+		if err := CheckCouponEligibility(ctx, tx, coupon, userID, lines); err != nil {
+			return nil, err
+		}
+		order.Discount = ApplyCouponDiscount(coupon, lines)
+		order.CouponCode = &coupon.Code
+	}
+
+	freeShipping := coupon != nil && coupon.Type == models.CouponFreeShipping
+	shipping, err := SelectShippingOption(ctx, tx, lines, order.Subtotal-order.Discount, freeShipping, req.ShippingMethodID)
+	if err != nil {
+		return nil, err
+	}
+	if shipping != nil {
+		order.ShippingMethodID = &shipping.MethodID
+		order.ShippingCost = shipping.Price
+	}
+
+	taxAddress := TaxAddress{Country: shipTo.Country, Region: shipTo.Region, PostalCode: shipTo.PostalCode}
+	order.Tax, err = CalculateTax(ctx, tx, taxAddress, lines)
+	if err != nil {
+		return nil, err
+	}
+	order.Total = roundCents(order.Subtotal - order.Discount + order.ShippingCost + order.Tax)
+
+	query := `INSERT INTO orders (user_id, subtotal, discount, coupon_code, shipping_method_id, shipping_cost, tax, total, status, shipping_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, userID, order.Subtotal, order.Discount, order.CouponCode, order.ShippingMethodID, order.ShippingCost,
+		order.Tax, order.Total, order.Status, shippingJSON).
+		Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		item := models.OrderItem{
+			OrderID:   order.ID,
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+			Discount:  line.Discount,
+			Tax:       line.Tax,
+			LineTotal: line.Total(),
+		}
+		query := `INSERT INTO order_items (order_id, product_id, quantity, unit_price, discount, tax, line_total)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		err := tx.QueryRowContext(ctx, query, item.OrderID, item.ProductID, item.Quantity, item.UnitPrice, item.Discount, item.Tax, item.LineTotal).
+			Scan(&item.ID)
+		if err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, item)
+	}
+
+	var alerts StockAlerts
+	if err := ReserveStock(ctx, tx, order.ID, lines, &alerts); err != nil {
+		return nil, err
+	}
+	if err := events.Record(ctx, tx, events.OrderCreated, "order", order.ID, order); err != nil {
+		return nil, err
+	}
+
+	if coupon != nil {
+		if err := RedeemCoupon(ctx, tx, coupon, userID, order.ID, order.Discount); err != nil {
+			return nil, err
+		}
+		if _, err := DetachCouponFromCart(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cart WHERE user_id=$1", userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	alerts.Send(ctx)
+	return &order, nil
+}
+
+// CancelOrder cancels an order that has not started shipping and returns its
+// stock to inventory
+func CancelOrder(ctx context.Context, orderID int, note string) (*models.Orders, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id=$1 FOR UPDATE", orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case "Partially Shipped", "Shipped", "Delivered", "Cancelled":
+		return nil, fmt.Errorf("%w as it is already %v", ErrOrderNotCancellable, status)
+	}
+
+	var order models.Orders
+	query := "UPDATE orders SET status='Cancelled' WHERE id=$1 RETURNING " + OrderColumns
+	if err := ScanOrder(tx.QueryRowContext(ctx, query, orderID), &order); err != nil {
+		return nil, err
+	}
+	if err := RestockOrder(ctx, tx, orderID, note); err != nil {
+		return nil, err
+	}
+	if err := ReleaseCoupon(ctx, tx, orderID); err != nil {
+		return nil, err
+	}
+	if err := events.RecordStatusChange(ctx, tx, orderID, status, order.Status); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdateOrderStatus sets an order's status and records the change. Cancelling
+// goes through CancelOrder instead, since it has to release stock, and a
+// cancelled order stays cancelled. Marking an unpaid order paid or shipped
+// books its sale, as a payment webhook would.
+func UpdateOrderStatus(ctx context.Context, orderID int, status string) (*models.Orders, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id=$1 FOR UPDATE", orderID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if previous == "Cancelled" {
+		return nil, ErrOrderCancelled
+	}
+
+	var order models.Orders
+	query := "UPDATE orders SET status=$1 WHERE id=$2 RETURNING " + OrderColumns
+	if err := ScanOrder(tx.QueryRowContext(ctx, query, status, orderID), &order); err != nil {
+		return nil, err
+	}
+	if slices.Contains(paidStatuses, status) {
+		if err := CompleteSale(ctx, tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+	if err := events.RecordStatusChange(ctx, tx, orderID, previous, status); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// OrderItems loads the lines of an order
+func OrderItems(ctx context.Context, q database.Querier, orderID int) ([]models.OrderItem, error) {
+	query := "SELECT id, order_id, product_id, quantity, unit_price, discount, tax, line_total FROM order_items WHERE order_id=$1 ORDER BY id"
+	rows, err := q.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.UnitPrice, &item.Discount, &item.Tax, &item.LineTotal); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     error
+		sale     bool
+	}{
+		{"Cancelled", "Paid", ErrOrderCancelled, false},
+		{"Cancelled", "Not Paid", ErrOrderCancelled, false},
+		{"Cancelled", "Shipped", ErrOrderCancelled, false},
+		{"Not Paid", "Paid", nil, true},
+		{"Not Paid", "Shipped", nil, true},
+		{"Paid", "Pending", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT status FROM orders"):
+					return dbtest.Row(tt.from)
+				case strings.Contains(query, "RETURNING "+OrderColumns):
+					return dbtest.Row(int64(40), int64(7), 50.0, 0.0, nil, nil, 0.0, 0.0, 50.0, tt.to, nil, time.Now())
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			_, err := UpdateOrderStatus(context.Background(), 40, tt.to)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil && len(db.Ran("UPDATE orders")) != 0 {
+				t.Error("a cancelled order was updated")
+			}
+			if sale := len(db.Ran("FROM inventory_movements")) > 0; sale != tt.sale {
+				t.Errorf("booked the sale = %v, want %v", sale, tt.sale)
+			}
+		})
+	}
+}
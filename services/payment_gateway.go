@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"e-commerce/config"
+	"e-commerce/tracing"
+	"strconv"
+
+	"github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/paymentintent"
+	"github.com/stripe/stripe-go/v78/webhook"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PaymentGateway is the boundary to the payment provider
+type PaymentGateway interface {
+	// CreatePaymentIntent starts a payment for an order; the order ID travels
+	// in the intent's metadata so webhook events can be matched to it
+	CreatePaymentIntent(ctx context.Context, orderID int, amountCents int64, currency string) (*stripe.PaymentIntent, error)
+	// ParseWebhook checks a webhook payload against its signature header and
+	// returns the event it carries
+	ParseWebhook(payload []byte, signature string) (stripe.Event, error)
+}
+
+// Gateway is the provider used by the payment service; main installs it from config
+var Gateway PaymentGateway
+
+// StripeGateway talks to Stripe and wraps every call in a client span
+type StripeGateway struct {
+	intents       *paymentintent.Client
+	webhookSecret string
+}
+
+func NewStripeGateway(cfg config.StripeConfig) *StripeGateway {
+	return &StripeGateway{
+		intents:       &paymentintent.Client{B: stripe.GetBackend(stripe.APIBackend), Key: cfg.SecretKey},
+		webhookSecret: cfg.WebhookSecret,
+	}
+}
+
+func (g *StripeGateway) CreatePaymentIntent(ctx context.Context, orderID int, amountCents int64, currency string) (*stripe.PaymentIntent, error) {
+	ctx, span := tracing.Tracer("e-commerce/services").Start(ctx, "stripe.PaymentIntent.create",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("payment.provider", "stripe"),
+			attribute.Int64("payment.amount_cents", amountCents),
+			attribute.String("payment.currency", currency),
+		))
+	defer span.End()
+
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(amountCents),
+		Currency: stripe.String(currency),
+	}
+	params.AddMetadata("order_id", strconv.Itoa(orderID))
+	params.Context = ctx
+
+	intent, err := g.intents.New(params)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "payment intent creation failed")
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("payment.intent_id", intent.ID))
+	return intent, nil
+}
+
+// ParseWebhook rejects payloads without a valid Stripe-Signature for the
+// endpoint's secret, and ones signed more than five minutes ago
+func (g *StripeGateway) ParseWebhook(payload []byte, signature string) (stripe.Event, error) {
+	return webhook.ConstructEvent(payload, signature, g.webhookSecret)
+}
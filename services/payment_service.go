@@ -1,22 +1,82 @@
 package services
 
 import (
+	"context"
 	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/logging"
 	"github.com/stripe/stripe-go/v78"
-	"github.com/stripe/stripe-go/v78/paymentintent"
 )
 
-func CreatePaymentIntent(userID int, amount int64, currency string) (*stripe.PaymentIntent, error) {
-	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(amount * 100)),
-		Currency: stripe.String(currency),
+func CreatePaymentIntent(ctx context.Context, orderID int, amount int64, currency string) (*stripe.PaymentIntent, error) {
+	intent, err := Gateway.CreatePaymentIntent(ctx, orderID, amount*100, currency)
+	if err != nil {
+		logging.FromContext(ctx).Error("stripe payment intent failed", "error", err, "amount", amount, "currency", currency)
+		return nil, err
 	}
-	
-	return paymentintent.New(params)
+	logging.FromContext(ctx).Info("stripe payment intent created", "payment_intent_id", intent.ID)
+	return intent, nil
 }
 
-func UpdatePaymentStatus(orderID int, status string) error {
+// paymentEvents maps the webhook statuses that settle a payment to their events
+var paymentEvents = map[string]string{
+	"completed": events.PaymentSucceeded,
+	"failed":    events.PaymentFailed,
+}
+
+type paymentEvent struct {
+	OrderID int    `json:"order_id"`
+	Status  string `json:"status"`
+}
+
+// UpdatePaymentStatus records the gateway's verdict on an order's payment. A
+// completed payment marks an unpaid order as Paid and turns its stock
+// reservations into sales.
+func UpdatePaymentStatus(ctx context.Context, orderID int, status string) error {
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := database.DB.BeginTx(dbCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := "UPDATE payments SET status=$1 WHERE order_id=$2"
-	_, err := database.DB.Exec(query, status, orderID)
-	return err
+	if _, err := tx.ExecContext(dbCtx, query, status, orderID); err != nil {
+		return err
+	}
+
+	if status == "completed" {
+		res, err := tx.ExecContext(dbCtx, "UPDATE orders SET status='Paid' WHERE id=$1 AND status='Not Paid'", orderID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := events.RecordStatusChange(dbCtx, tx, orderID, "Not Paid", "Paid"); err != nil {
+				return err
+			}
+		} else {
+			// a payment that lands after the reservation expired has nothing left to buy
+			var orderStatus string
+			if err := tx.QueryRowContext(dbCtx, "SELECT status FROM orders WHERE id=$1", orderID).Scan(&orderStatus); err == nil && orderStatus == "Cancelled" {
+				logging.FromContext(ctx).Warn("payment completed for a cancelled order, refund required", "order_id", orderID)
+			}
+		}
+		if err := CompleteSale(dbCtx, tx, orderID); err != nil {
+			return err
+		}
+	}
+
+	if eventType, ok := paymentEvents[status]; ok {
+		if err := events.Record(dbCtx, tx, eventType, "order", orderID, paymentEvent{OrderID: orderID, Status: status}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("payment status updated", "order_id", orderID, "status", status)
+	return nil
 }
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/jobs"
+	"e-commerce/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ApplyPriceJob is the job kind that announces a product's new effective price
+// when a scheduled price starts or ends
+const ApplyPriceJob = "prices.apply"
+
+var (
+	ErrPriceNotFound      = errors.New("scheduled price not found")
+	ErrPriceOverlap       = errors.New("overlaps another scheduled price for this product")
+	ErrInvalidPriceWindow = errors.New("ends_at must be after starts_at")
+	ErrSaleAboveCompareAt = errors.New("sale_price must be below compare_at_price, or below the list price without one")
+)
+
+// SaleJoin attaches the scheduled price in effect now, if any, to the products
+// row aliased p. A product's windows never overlap, so at most one matches.
+const SaleJoin = `LEFT JOIN LATERAL (
+		SELECT id AS sale_id, sale_price, compare_at_price AS sale_compare_at, ends_at AS sale_ends_at FROM product_prices
+		WHERE product_id = p.id AND starts_at <= NOW() AND (ends_at IS NULL OR ends_at > NOW()) LIMIT 1) sale ON TRUE`
+
+// EffectivePrice is what the product p sells for now, in queries with SaleJoin
+const EffectivePrice = "COALESCE(sale.sale_price, p.price)"
+
+// CompareAtPrice is the original price shown next to a running sale: the sale's
+// own compare-at price or else the list price, and only when above the sale price
+const CompareAtPrice = "CASE WHEN COALESCE(sale.sale_compare_at, p.price) > sale.sale_price THEN COALESCE(sale.sale_compare_at, p.price) END"
+
+const priceColumns = "id, product_id, sale_price, compare_at_price, starts_at, ends_at, created_at"
+
+func scanPrice(row interface{ Scan(...interface{}) error }, sp *models.ScheduledPrice) error {
+	return row.Scan(&sp.ID, &sp.ProductID, &sp.SalePrice, &sp.CompareAtPrice, &sp.StartsAt, &sp.EndsAt, &sp.CreatedAt)
+}
+
+// ScheduledPrices returns a product's price schedule, past windows included,
+// in start order
+func ScheduledPrices(ctx context.Context, productID int) ([]models.ScheduledPrice, error) {
+	var exists bool
+	if err := database.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM products WHERE id=$1)", productID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+
+	query := "SELECT " + priceColumns + " FROM product_prices WHERE product_id=$1 ORDER BY starts_at"
+	rows, err := database.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []models.ScheduledPrice{}
+	for rows.Next() {
+		var sp models.ScheduledPrice
+		if err := scanPrice(rows, &sp); err != nil {
+			return nil, err
+		}
+		prices = append(prices, sp)
+	}
+	return prices, rows.Err()
+}
+
+// CreateScheduledPrice adds a window to a product's price schedule
+func CreateScheduledPrice(ctx context.Context, sp *models.ScheduledPrice) error {
+	if err := checkPriceWindow(sp); err != nil {
+		return err
+	}
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockPricing(ctx, tx, sp.ProductID, 0, sp)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO product_prices (product_id, sale_price, compare_at_price, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING ` + priceColumns
+	err = scanPrice(tx.QueryRowContext(ctx, query, sp.ProductID, sp.SalePrice, sp.CompareAtPrice, sp.StartsAt, sp.EndsAt), sp)
+	if err != nil {
+		return priceError(err)
+	}
+	if err := priceScheduleChanged(ctx, tx, sp.ProductID, before, sp); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateScheduledPrice replaces one window of a product's price schedule
+func UpdateScheduledPrice(ctx context.Context, sp *models.ScheduledPrice) error {
+	if err := checkPriceWindow(sp); err != nil {
+		return err
+	}
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockPricing(ctx, tx, sp.ProductID, sp.ID, sp)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE product_prices SET sale_price=$3, compare_at_price=$4, starts_at=$5, ends_at=$6
+		WHERE id=$1 AND product_id=$2 RETURNING ` + priceColumns
+	err = scanPrice(tx.QueryRowContext(ctx, query, sp.ID, sp.ProductID, sp.SalePrice, sp.CompareAtPrice, sp.StartsAt, sp.EndsAt), sp)
+	if err == sql.ErrNoRows {
+		return ErrPriceNotFound
+	}
+	if err != nil {
+		return priceError(err)
+	}
+	if err := priceScheduleChanged(ctx, tx, sp.ProductID, before, sp); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteScheduledPrice removes one window of a product's price schedule. Jobs
+// queued for its start or end still run, but find nothing new to announce.
+func DeleteScheduledPrice(ctx context.Context, productID, priceID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockPricing(ctx, tx, productID, priceID, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM product_prices WHERE id=$1 AND product_id=$2", priceID, productID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPriceNotFound
+	}
+	if err := priceScheduleChanged(ctx, tx, productID, before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func checkPriceWindow(sp *models.ScheduledPrice) error {
+	if sp.EndsAt != nil && !sp.EndsAt.After(sp.StartsAt) {
+		return ErrInvalidPriceWindow
+	}
+	if sp.CompareAtPrice != nil && sp.SalePrice >= *sp.CompareAtPrice {
+		return ErrSaleAboveCompareAt
+	}
+	return nil
+}
+
+// priceError maps the schema's overlap constraint to ErrPriceOverlap
+func priceError(err error) error {
+	if strings.Contains(err.Error(), "violates exclusion constraint") {
+		return ErrPriceOverlap
+	}
+	return err
+}
+
+// lockPricing locks the product, so changes to its schedule are serialized,
+// and returns its effective price before the change. A non-zero priceID must be
+// one of the product's windows. With a window to save it also checks that no
+// other window overlaps it, and that a window without a compare-at price sells
+// below the list price it defaults to.
+func lockPricing(ctx context.Context, tx *sql.Tx, productID, priceID int, window *models.ScheduledPrice) (float64, error) {
+	var before, listPrice float64
+	query := "SELECT " + EffectivePrice + ", p.price FROM products p " + SaleJoin + " WHERE p.id=$1 FOR UPDATE OF p"
+	err := tx.QueryRowContext(ctx, query, productID).Scan(&before, &listPrice)
+	if err == sql.ErrNoRows {
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if priceID != 0 {
+		var exists bool
+		query = "SELECT EXISTS (SELECT 1 FROM product_prices WHERE id=$1 AND product_id=$2)"
+		if err := tx.QueryRowContext(ctx, query, priceID, productID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrPriceNotFound
+		}
+	}
+	if window == nil {
+		return before, nil
+	}
+	if window.CompareAtPrice == nil && window.SalePrice >= listPrice {
+		return 0, ErrSaleAboveCompareAt
+	}
+
+	var overlaps bool
+	query = `SELECT EXISTS (SELECT 1 FROM product_prices WHERE product_id=$1 AND id <> $2
+		AND starts_at < COALESCE($4::timestamptz, 'infinity') AND COALESCE(ends_at, 'infinity') > $3)`
+	if err := tx.QueryRowContext(ctx, query, productID, priceID, window.StartsAt, window.EndsAt).Scan(&overlaps); err != nil {
+		return 0, err
+	}
+	if overlaps {
+		return 0, ErrPriceOverlap
+	}
+	return before, nil
+}
+
+// priceScheduleChanged bumps the product's version, records a product.updated
+// event if its effective price changed right away, and queues ApplyPriceJob
+// for the window's future start and end so those changes are announced too
+func priceScheduleChanged(ctx context.Context, tx *sql.Tx, productID int, before float64, window *models.ScheduledPrice) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET version = version + 1 WHERE id=$1", productID); err != nil {
+		return err
+	}
+	var p models.Products
+	if err := ScanProduct(tx.QueryRowContext(ctx, "SELECT "+ProductColumns+" FROM products p "+SaleJoin+" WHERE id=$1", productID), &p); err != nil {
+		return err
+	}
+	if p.EffectivePrice != before {
+		if err := recordProductEvent(ctx, tx, events.ProductUpdated, &p); err != nil {
+			return err
+		}
+	}
+	if window == nil {
+		return nil
+	}
+
+	boundaries := []time.Time{window.StartsAt}
+	if window.EndsAt != nil {
+		boundaries = append(boundaries, *window.EndsAt)
+	}
+	for _, at := range boundaries {
+		if !at.After(time.Now()) {
+			continue
+		}
+		_, err := jobs.Enqueue(ctx, tx, jobs.NewJob{
+			Kind:      ApplyPriceJob,
+			Payload:   priceJob{ProductID: productID},
+			RunAt:     at,
+			UniqueKey: fmt.Sprintf("price:%d:%d", productID, at.Unix()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type priceJob struct {
+	ProductID int `json:"product_id"`
+}
+
+// ApplyPriceChange is the job handler for ApplyPriceJob. The effective price
+// is resolved on every read, so the job only records a product.updated event
+// with it, for webhooks and wishlist price-drop emails. A job whose window was
+// moved or deleted finds the price already announced and records nothing.
+func ApplyPriceChange(ctx context.Context, raw json.RawMessage) error {
+	var job priceJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return err
+	}
+
+	ctx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the lock keeps jobs for the same product from announcing a price twice
+	var announced *float64
+	err = tx.QueryRowContext(ctx, "SELECT announced_price FROM products WHERE id=$1 FOR UPDATE", job.ProductID).Scan(&announced)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var p models.Products
+	err = ScanProduct(tx.QueryRowContext(ctx, "SELECT "+ProductColumns+" FROM products p "+SaleJoin+" WHERE id=$1", job.ProductID), &p)
+	if err != nil {
+		return err
+	}
+	if announced != nil && *announced == p.EffectivePrice {
+		return nil
+	}
+	if err := recordProductEvent(ctx, tx, events.ProductUpdated, &p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
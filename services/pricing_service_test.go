@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyPriceChangeOnlyAnnouncesNewPrices(t *testing.T) {
+	tests := []struct {
+		name      string
+		announced interface{}
+		want      bool
+	}{
+		{"sale started", 20.0, true},
+		{"window moved or deleted", 15.0, false},
+		{"never announced", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT announced_price"):
+					return dbtest.Row(tt.announced)
+				case strings.Contains(query, "SELECT "+ProductColumns):
+					return dbtest.Result{Rows: [][]driver.Value{productRow(4, 20, 15)}}
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			if err := ApplyPriceChange(context.Background(), []byte(`{"product_id": 4}`)); err != nil {
+				t.Fatal(err)
+			}
+			recorded := len(db.Ran("INSERT INTO outbox_events")) == 1
+			if recorded != tt.want {
+				t.Errorf("recorded product.updated = %v, want %v", recorded, tt.want)
+			}
+			if updates := db.Ran("SET announced_price"); tt.want && (len(updates) != 1 || updates[0].Args[1] != 15.0) {
+				t.Errorf("announced price updates = %v, want 15", updates)
+			}
+		})
+	}
+}
+
+func TestSalePriceMustBeBelowListPriceWithoutCompareAt(t *testing.T) {
+	compareAt := 30.0
+	tests := []struct {
+		salePrice float64
+		compareAt *float64
+		want      error
+	}{
+		{25, nil, ErrSaleAboveCompareAt},
+		{20, nil, ErrSaleAboveCompareAt},
+		{15, nil, nil},
+		{25, &compareAt, nil},
+		{30, &compareAt, ErrSaleAboveCompareAt},
+	}
+	for _, tt := range tests {
+		dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "FOR UPDATE OF p"):
+				// effective and list price
+				return dbtest.Row(20.0, 20.0)
+			case strings.Contains(query, "SELECT EXISTS"):
+				return dbtest.Row(false)
+			case strings.Contains(query, "INSERT INTO product_prices"):
+				return dbtest.Row(int64(1), int64(4), tt.salePrice, nil, time.Now().Add(time.Hour), nil, time.Now())
+			case strings.Contains(query, "SELECT "+ProductColumns):
+				return dbtest.Result{Rows: [][]driver.Value{productRow(4, 20, 20)}}
+			}
+			return dbtest.Result{RowsAffected: 1}
+		})
+
+		sp := models.ScheduledPrice{ProductID: 4, SalePrice: tt.salePrice, CompareAtPrice: tt.compareAt, StartsAt: time.Now().Add(time.Hour)}
+		if err := CreateScheduledPrice(context.Background(), &sp); !errors.Is(err, tt.want) {
+			t.Errorf("sale %v, compare-at %v: err = %v, want %v", tt.salePrice, tt.compareAt, err, tt.want)
+		}
+	}
+}
+
+func TestOverlapConstraintIsReportedAsOverlap(t *testing.T) {
+	dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "FOR UPDATE OF p"):
+			return dbtest.Row(20.0, 20.0)
+		case strings.Contains(query, "SELECT EXISTS"):
+			return dbtest.Row(false)
+		case strings.Contains(query, "INSERT INTO product_prices"):
+			return dbtest.Result{Err: errors.New(`ERROR: conflicting key value violates exclusion constraint "product_prices_product_id_tstzrange_excl" (SQLSTATE 23P01)`)}
+		}
+		return dbtest.Result{RowsAffected: 1}
+	})
+
+	sp := models.ScheduledPrice{ProductID: 4, SalePrice: 15, StartsAt: time.Now().Add(time.Hour)}
+	if err := CreateScheduledPrice(context.Background(), &sp); !errors.Is(err, ErrPriceOverlap) {
+		t.Errorf("err = %v, want ErrPriceOverlap", err)
+	}
+}
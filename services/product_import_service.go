@@ -0,0 +1,577 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/jobs"
+	"e-commerce/logging"
+	"e-commerce/models"
+	"e-commerce/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportProductsJob is the job kind that runs a large product import
+const ImportProductsJob = "products.import"
+
+// Import and export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	ErrImportNotFound = errors.New("import not found")
+	// ErrInvalidImport means the file as a whole cannot be read; problems with
+	// single rows are reported per row instead
+	ErrInvalidImport = errors.New("invalid import file")
+)
+
+// ImportColumns are the product fields an import row may set, in the order
+// exports write them. sku is required on every row and matches the row to an
+// existing product; stock is the target balance.
+var ImportColumns = []string{"sku", "name", "description", "price", "stock", "category", "tax_class", "weight", "low_stock_threshold"}
+
+const (
+	// ImportSyncRows is the largest import run within the request; bigger files
+	// are processed by a background job
+	ImportSyncRows = 200
+	// maxImportErrors bounds the row errors kept in a report
+	maxImportErrors = 1000
+	// importCheckpoint is how many rows a background import processes between
+	// saving its progress
+	importCheckpoint = 100
+)
+
+// ImportRow is one row of an import file. Fields holds the JSON value of each
+// column present in the row; a row that could not be read has Errors instead.
+type ImportRow struct {
+	Line   int
+	Fields map[string]json.RawMessage
+	Errors []string
+}
+
+func (row ImportRow) sku() string {
+	var sku string
+	json.Unmarshal(row.Fields["sku"], &sku)
+	return strings.TrimSpace(sku)
+}
+
+// ParseImport reads every row of a CSV or NDJSON file. CSV files need a header
+// naming a subset of ImportColumns that includes sku; empty cells are null.
+func ParseImport(format string, data []byte) ([]ImportRow, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatNDJSON:
+		return parseNDJSON(data)
+	}
+	return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidImport, format)
+}
+
+func parseCSV(data []byte) ([]ImportRow, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(ImportColumns, column) {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidImport, column)
+		}
+		if slices.Contains(header[:i], column) {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidImport, column)
+		}
+		header[i] = column
+	}
+	if !slices.Contains(header, "sku") {
+		return nil, fmt.Errorf("%w: missing sku column", ErrInvalidImport)
+	}
+
+	rows := []ImportRow{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		line, _ := r.FieldPos(0)
+		if errors.Is(err, csv.ErrFieldCount) {
+			rows = append(rows, ImportRow{Line: line, Errors: []string{fmt.Sprintf("expected %d fields, got %d", len(header), len(record))}})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+
+		row := ImportRow{Line: line, Fields: map[string]json.RawMessage{}}
+		for i, cell := range record {
+			value, err := csvValue(header[i], cell)
+			if err != nil {
+				row.Errors = append(row.Errors, err.Error())
+				continue
+			}
+			row.Fields[header[i]] = value
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvValue converts a cell to the JSON value of its column
+func csvValue(column, cell string) (json.RawMessage, error) {
+	if strings.TrimSpace(cell) == "" {
+		return json.RawMessage("null"), nil
+	}
+	var value interface{} = cell
+	switch column {
+	case "price", "weight":
+		f, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: must be a number", column)
+		}
+		value = f
+	case "stock", "low_stock_threshold":
+		n, err := strconv.Atoi(strings.TrimSpace(cell))
+		if err != nil {
+			return nil, fmt.Errorf("%s: must be a whole number", column)
+		}
+		value = n
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: must be a number", column)
+	}
+	return raw, nil
+}
+
+func parseNDJSON(data []byte) ([]ImportRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	rows := []ImportRow{}
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := ImportRow{Line: line}
+		if err := json.Unmarshal(text, &row.Fields); err != nil || row.Fields == nil {
+			row.Errors = []string{"not a JSON object"}
+			rows = append(rows, row)
+			continue
+		}
+		for field := range row.Fields {
+			if !slices.Contains(ImportColumns, field) {
+				row.Errors = append(row.Errors, fmt.Sprintf("unknown field %q", field))
+			}
+		}
+		sort.Strings(row.Errors)
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	return rows, nil
+}
+
+const importColumns = "id, format, dry_run, status, total_rows, processed_rows, created, updated, unchanged, failed, errors, created_by, created_at, finished_at"
+
+func scanImport(row interface{ Scan(...interface{}) error }, imp *models.ProductImport) error {
+	var rowErrors []byte
+	err := row.Scan(&imp.ID, &imp.Format, &imp.DryRun, &imp.Status, &imp.TotalRows, &imp.Processed, &imp.Created, &imp.Updated,
+		&imp.Unchanged, &imp.Failed, &rowErrors, &imp.CreatedBy, &imp.CreatedAt, &imp.FinishedAt)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(rowErrors, &imp.Errors)
+}
+
+// StartImport records an import of data and runs it. Files of up to
+// ImportSyncRows rows are processed before it returns; larger ones are stored
+// and left pending for a background job, whose progress GetImport reports.
+func StartImport(ctx context.Context, format string, data []byte, dryRun bool, userID int) (*models.ProductImport, error) {
+	rows, err := ParseImport(format, data)
+	if err != nil {
+		return nil, err
+	}
+	background := len(rows) > ImportSyncRows
+
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+	tx, err := database.DB.BeginTx(dbCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var stored []byte
+	if background {
+		stored = data
+	}
+	imp := models.ProductImport{}
+	query := `INSERT INTO product_imports (format, dry_run, total_rows, data, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + importColumns
+	if err := scanImport(tx.QueryRowContext(dbCtx, query, format, dryRun, len(rows), stored, userID), &imp); err != nil {
+		return nil, err
+	}
+	if background {
+		_, err := jobs.Enqueue(dbCtx, tx, jobs.NewJob{
+			Kind:      ImportProductsJob,
+			Payload:   importJob{ImportID: imp.ID},
+			UniqueKey: fmt.Sprintf("product-import:%d", imp.ID),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if background {
+		return &imp, nil
+	}
+	if err := runImport(ctx, &imp, rows, userID); err != nil {
+		failImport(ctx, &imp)
+		return nil, err
+	}
+	return &imp, nil
+}
+
+// GetImport returns an import's report
+func GetImport(ctx context.Context, importID int) (*models.ProductImport, error) {
+	var imp models.ProductImport
+	err := scanImport(database.DB.QueryRowContext(ctx, "SELECT "+importColumns+" FROM product_imports WHERE id=$1", importID), &imp)
+	if err == sql.ErrNoRows {
+		return nil, ErrImportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+type importJob struct {
+	ImportID int `json:"import_id"`
+}
+
+// RunProductImport is the job handler for ImportProductsJob. It resumes from the
+// last saved checkpoint, and rows are upserts, so repeating the few rows
+// processed after it is harmless. When the last attempt fails the import is
+// marked failed; its file is kept so retrying the dead job resumes it.
+func RunProductImport(ctx context.Context, raw json.RawMessage) error {
+	var job importJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return err
+	}
+
+	dbCtx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+	var data []byte
+	query := "UPDATE product_imports SET status=$2, finished_at=NULL WHERE id=$1 AND status <> $3 RETURNING data"
+	err := database.DB.QueryRowContext(dbCtx, query, job.ImportID, models.ImportRunning, models.ImportCompleted).Scan(&data)
+	if err == sql.ErrNoRows {
+		// already completed, or deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	imp, err := GetImport(dbCtx, job.ImportID)
+	if err != nil {
+		return err
+	}
+
+	userID := 0
+	if imp.CreatedBy != nil {
+		userID = *imp.CreatedBy
+	}
+	rows, err := ParseImport(imp.Format, data)
+	if err == nil {
+		err = runImport(ctx, imp, rows, userID)
+	}
+	if err != nil && jobs.LastAttempt(ctx) {
+		failImport(ctx, imp)
+	}
+	return err
+}
+
+// runImport processes the rows from imp.Processed on, saving its progress every
+// importCheckpoint rows and marking the import completed at the end. Rows that
+// fail are reported and skipped; other errors stop the import.
+func runImport(ctx context.Context, imp *models.ProductImport, rows []ImportRow, userID int) error {
+	// a dry run writes nothing, so it keeps what each SKU would hold after the
+	// rows so far; a resumed one replays the rows it already counted
+	staged := map[string][]byte{}
+	if imp.DryRun {
+		for _, row := range rows[:imp.Processed] {
+			if _, _, err := importRow(ctx, row, true, staged, userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, row := range rows[imp.Processed:] {
+		outcome, errs, err := importRow(ctx, row, imp.DryRun, staged, userID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(errs) > 0:
+			imp.Failed++
+			if len(imp.Errors) < maxImportErrors {
+				imp.Errors = append(imp.Errors, models.ImportRowError{Row: row.Line, SKU: row.sku(), Errors: errs})
+			}
+		case outcome == importCreated:
+			imp.Created++
+		case outcome == importUpdated:
+			imp.Updated++
+		default:
+			imp.Unchanged++
+		}
+		imp.Processed++
+
+		if imp.Processed%importCheckpoint == 0 && imp.Processed < len(rows) {
+			if err := saveImport(ctx, imp); err != nil {
+				return err
+			}
+		}
+	}
+	imp.Status = models.ImportCompleted
+	return saveImport(ctx, imp)
+}
+
+// failImport marks an import that stopped on an error as failed, keeping the
+// progress it made. It is best effort: the caller reports the original error.
+func failImport(ctx context.Context, imp *models.ProductImport) {
+	imp.Status = models.ImportFailed
+	if err := saveImport(context.WithoutCancel(ctx), imp); err != nil {
+		logging.FromContext(ctx).Error("Recording import failure failed", "import_id", imp.ID, "error", err)
+	}
+}
+
+// saveImport stores an import's progress, and its status once it is completed
+// or failed. A completed import drops its file.
+func saveImport(ctx context.Context, imp *models.ProductImport) error {
+	ctx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	if imp.Errors == nil {
+		imp.Errors = []models.ImportRowError{}
+	}
+	rowErrors, err := json.Marshal(imp.Errors)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE product_imports SET processed_rows=$2, created=$3, updated=$4, unchanged=$5, failed=$6, errors=$7
+		WHERE id=$1`
+	if imp.Status == models.ImportCompleted || imp.Status == models.ImportFailed {
+		query = `UPDATE product_imports SET processed_rows=$2, created=$3, updated=$4, unchanged=$5, failed=$6, errors=$7,
+			status=$8, data = CASE WHEN $8 = 'completed' THEN NULL ELSE data END, finished_at=NOW()
+		WHERE id=$1 RETURNING finished_at`
+		return database.DB.QueryRowContext(ctx, query, imp.ID, imp.Processed, imp.Created, imp.Updated, imp.Unchanged, imp.Failed, rowErrors,
+			imp.Status).Scan(&imp.FinishedAt)
+	}
+	_, err = database.DB.ExecContext(ctx, query, imp.ID, imp.Processed, imp.Created, imp.Updated, imp.Unchanged, imp.Failed, rowErrors)
+	return err
+}
+
+const (
+	importCreated = iota + 1
+	importUpdated
+	importUnchanged
+)
+
+// importRow upserts the product a row describes. The row is merged onto the
+// product with its SKU, so columns it leaves out keep their values, or onto an
+// empty product if there is none, and the result is validated like a PUT. In a
+// dry run a SKU in staged is merged onto what earlier rows made of it instead.
+// Problems with the row are returned as errs; err is for failures that stop
+// the whole import.
+func importRow(ctx context.Context, row ImportRow, dryRun bool, staged map[string][]byte, userID int) (outcome int, errs []string, err error) {
+	if len(row.Errors) > 0 {
+		return 0, row.Errors, nil
+	}
+	sku := row.sku()
+	if sku == "" {
+		return 0, []string{"sku: is required"}, nil
+	}
+	row.Fields["sku"], _ = json.Marshal(sku)
+
+	ctx, cancel := database.WithTimeout(ctx)
+	defer cancel()
+
+	var current *models.Products
+	var p models.Products
+	err = ScanProduct(database.DB.QueryRowContext(ctx, "SELECT "+ProductColumns+" FROM products p "+SaleJoin+" WHERE sku=$1", sku), &p)
+	switch {
+	case err == nil:
+		current = &p
+	case err != sql.ErrNoRows:
+		return 0, nil, err
+	}
+
+	doc := []byte("{}")
+	var before models.ProductRequest
+	exists := current != nil
+	if current != nil {
+		before = models.ProductRequest{SKU: current.SKU, Name: current.Name, Description: current.Description, Price: current.Price,
+			Stock: current.Stock, Category: current.Category, TaxClass: current.TaxClass, Weight: current.Weight,
+			LowStockThreshold: current.LowStockThreshold}
+		if doc, err = json.Marshal(before); err != nil {
+			return 0, nil, err
+		}
+	}
+	if dryRun && staged[sku] != nil {
+		doc, exists = staged[sku], true
+	}
+	patch, err := json.Marshal(row.Fields)
+	if err != nil {
+		return 0, nil, err
+	}
+	merged, err := utils.MergePatch(doc, patch)
+	if err != nil {
+		return 0, []string{err.Error()}, nil
+	}
+	var req models.ProductRequest
+	if err := json.Unmarshal(merged, &req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return 0, []string{typeErr.Field + ": has the wrong type"}, nil
+		}
+		return 0, []string{err.Error()}, nil
+	}
+	if req.TaxClass == "" {
+		req.TaxClass = DefaultTaxClass
+	}
+	if verrs := utils.Validate(req); verrs != nil {
+		for field, messages := range verrs {
+			for _, message := range messages {
+				errs = append(errs, field+": "+message)
+			}
+		}
+		sort.Strings(errs)
+		return 0, errs, nil
+	}
+
+	product := models.Products{SKU: req.SKU, Name: req.Name, Description: req.Description, Price: req.Price, Stock: req.Stock,
+		Category: req.Category, TaxClass: req.TaxClass, Weight: req.Weight, LowStockThreshold: req.LowStockThreshold}
+	if dryRun {
+		after, err := json.Marshal(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !exists {
+			staged[sku] = after
+			return importCreated, nil, nil
+		}
+		if bytes.Equal(after, doc) {
+			return importUnchanged, nil, nil
+		}
+		staged[sku] = after
+		return importUpdated, nil, nil
+	}
+	if current == nil {
+		if err := CreateProduct(ctx, &product, userID); err != nil {
+			if errors.Is(err, ErrDuplicateSKU) {
+				return 0, []string{err.Error()}, nil
+			}
+			return 0, nil, err
+		}
+		return importCreated, nil, nil
+	}
+
+	catalog := req
+	catalog.Stock = before.Stock
+	changed, err := json.Marshal(catalog)
+	if err != nil {
+		return 0, nil, err
+	}
+	catalogChanged := !bytes.Equal(changed, doc)
+	stockChanged := req.Stock != before.Stock
+	if !catalogChanged && !stockChanged {
+		return importUnchanged, nil, nil
+	}
+
+	if catalogChanged {
+		product.ID = current.ID
+		if err := UpdateProduct(ctx, &product, nil, false); err != nil {
+			if errors.Is(err, ErrDuplicateSKU) || errors.Is(err, ErrPriceBelowSale) {
+				return 0, []string{err.Error()}, nil
+			}
+			return 0, nil, err
+		}
+	}
+	if stockChanged {
+		if err := setStock(ctx, current.ID, req.Stock, userID); err != nil {
+			return 0, nil, err
+		}
+	}
+	return importUpdated, nil, nil
+}
+
+// setStock books the adjustment that brings a product's balance to target. The
+// difference is taken under a row lock, so movements made since the import
+// read the product are not undone.
+func setStock(ctx context.Context, productID, target, userID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	if err := tx.QueryRowContext(ctx, "SELECT stock FROM products WHERE id=$1 FOR UPDATE", productID).Scan(&stock); err != nil {
+		return err
+	}
+	if stock == target {
+		return nil
+	}
+	var alerts StockAlerts
+	m := models.InventoryMovement{ProductID: productID, Kind: models.MovementAdjustment, Quantity: target - stock, Note: "product import",
+		CreatedBy: &userID}
+	if err := RecordMovement(ctx, tx, &m, &alerts); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	alerts.Send(ctx)
+	return nil
+}
+
+// ExportProducts calls fn with every product, or only active ones unless
+// archived is set, in ID order. It reads from a cursor rather than loading the
+// catalog, so callers can stream the result.
+func ExportProducts(ctx context.Context, archived bool, fn func(models.Products) error) error {
+	query := "SELECT " + ProductColumns + " FROM products p " + SaleJoin + " WHERE ($1 OR archived_at IS NULL) ORDER BY id"
+	rows, err := database.Reader().QueryContext(ctx, query, archived)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Products
+		if err := ScanProduct(rows, &p); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
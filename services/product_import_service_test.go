@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRunMergesRepeatedSKUs(t *testing.T) {
+	dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "UPDATE product_imports") {
+			return dbtest.Row(time.Now())
+		}
+		// no product has the SKU yet
+		return dbtest.Result{}
+	})
+	rows, err := ParseImport(FormatNDJSON, []byte(`{"sku": "L-1", "name": "Lamp", "price": 20}
+{"sku": "L-1", "price": 25}
+{"sku": "L-1", "price": 25}
+{"sku": "L-1", "name": null}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imp := models.ProductImport{DryRun: true}
+	if err := runImport(context.Background(), &imp, rows, 1); err != nil {
+		t.Fatal(err)
+	}
+	if imp.Created != 1 || imp.Updated != 1 || imp.Unchanged != 1 || imp.Failed != 1 {
+		t.Errorf("created %d, updated %d, unchanged %d, failed %d; want 1 of each", imp.Created, imp.Updated, imp.Unchanged, imp.Failed)
+	}
+	if len(imp.Errors) != 1 || imp.Errors[0].Row != 4 {
+		t.Errorf("errors = %+v, want row 4 missing its name", imp.Errors)
+	}
+}
+
+func TestStartImportMarksFailedImports(t *testing.T) {
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "INSERT INTO product_imports"):
+			return dbtest.Row(int64(7), FormatCSV, false, models.ImportPending, int64(1), int64(0), int64(0), int64(0), int64(0),
+				int64(0), []byte("[]"), int64(1), time.Now(), nil)
+		case strings.Contains(query, "UPDATE product_imports"):
+			return dbtest.Row(time.Now())
+		case strings.Contains(query, "FROM products"):
+			return dbtest.Result{Err: errors.New("connection reset")}
+		}
+		return dbtest.Result{}
+	})
+
+	if _, err := StartImport(context.Background(), FormatCSV, []byte("sku,name,price\nL-1,Lamp,20\n"), false, 1); err == nil {
+		t.Fatal("import succeeded despite the database failing")
+	}
+	saved := db.Ran("UPDATE product_imports")
+	if len(saved) != 1 || saved[0].Args[7] != models.ImportFailed {
+		t.Errorf("saved %v, want the import marked failed", saved)
+	}
+}
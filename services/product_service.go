@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/models"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrVersionConflict means the product changed since the client read it
+	ErrVersionConflict = errors.New("product was modified since it was read")
+	ErrDuplicateSKU    = errors.New("another product already has this SKU")
+	// ErrPriceBelowSale means the new list price would undercut a sale that
+	// has no compare-at price, making the sale dearer than the list price
+	ErrPriceBelowSale = errors.New("price must stay above the sale_price of current and upcoming sales without a compare_at_price")
+)
+
+// ProductColumns lists the columns read by ScanProduct, in order. Queries must
+// alias the products row as p and include SaleJoin.
+const ProductColumns = "id, sku, name, description, price, " + EffectivePrice + ", " + CompareAtPrice + ", sale.sale_id, sale.sale_ends_at, " +
+	"stock, category, tax_class, weight, low_stock_threshold, " + RatingColumns + ", archived_at, version, created_at"
+
+func ScanProduct(row interface{ Scan(...interface{}) error }, p *models.Products) error {
+	return row.Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.EffectivePrice, &p.CompareAtPrice, &p.SaleID, &p.SaleEndsAt,
+		&p.Stock, &p.Category, &p.TaxClass, &p.Weight, &p.LowStockThreshold, &p.RatingCount, &p.AverageRating, &p.ArchivedAt, &p.Version, &p.CreatedAt)
+}
+
+// ListProducts returns the storefront catalog, or with archived set only the
+// archived products
+func ListProducts(ctx context.Context, archived bool) ([]models.Products, error) {
+	query := "SELECT " + ProductColumns + " FROM products p " + SaleJoin + " WHERE archived_at IS NULL ORDER BY id"
+	if archived {
+		query = "SELECT " + ProductColumns + " FROM products p " + SaleJoin + " WHERE archived_at IS NOT NULL ORDER BY archived_at DESC"
+	}
+	rows, err := database.Reader().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Products{}
+	for rows.Next() {
+		var p models.Products
+		if err := ScanProduct(rows, &p); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// GetProduct returns a product by ID. Archived products are still returned,
+// with ArchivedAt set, so order history can resolve what was bought. Reads
+// pass database.Reader(); a write checking If-Match or merging a patch passes
+// database.DB, since a lagging replica would report an older version.
+func GetProduct(ctx context.Context, q database.Querier, productID int) (*models.Products, error) {
+	var p models.Products
+	err := ScanProduct(q.QueryRowContext(ctx, "SELECT "+ProductColumns+" FROM products p "+SaleJoin+" WHERE id=$1", productID), &p)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateProduct inserts a product with an empty balance and books its opening
+// stock as a receipt, so the ledger accounts for every unit from the start
+func CreateProduct(ctx context.Context, p *models.Products, userID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	normalizeSKU(p)
+	query := `INSERT INTO products (sku, name, description, price, category, tax_class, weight, low_stock_threshold)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, version, created_at`
+	err = tx.QueryRowContext(ctx, query, p.SKU, p.Name, p.Description, p.Price, p.Category, p.TaxClass, p.Weight, p.LowStockThreshold).
+		Scan(&p.ID, &p.Version, &p.CreatedAt)
+	if err != nil {
+		return skuError(err)
+	}
+	// a new product has no price schedule yet
+	p.EffectivePrice = p.Price
+
+	var alerts StockAlerts
+	if p.Stock > 0 {
+		receipt := models.InventoryMovement{ProductID: p.ID, Kind: models.MovementReceipt, Quantity: p.Stock, Note: "opening stock", CreatedBy: &userID}
+		if err := RecordMovement(ctx, tx, &receipt, &alerts); err != nil {
+			return err
+		}
+	}
+	if err := recordProductEvent(ctx, tx, events.ProductCreated, p); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	alerts.Send(ctx)
+	return nil
+}
+
+// UpdateProduct replaces a product's catalog fields and bumps its version.
+// Stock is not touched; it only changes through inventory movements. With a
+// non-nil version the update only applies if the product is still at that
+// version, and fails with ErrVersionConflict otherwise. With keepSKU the
+// product keeps its SKU whatever p.SKU holds. A price at or below a current or
+// upcoming sale that has no compare-at price fails with ErrPriceBelowSale.
+func UpdateProduct(ctx context.Context, p *models.Products, version *int, keepSKU bool) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	normalizeSKU(p)
+	query := `WITH p AS (
+			UPDATE products SET sku = CASE WHEN $11 THEN sku ELSE $1 END, name=$2, description=$3, price=$4, category=$5, tax_class=$6, weight=$7, low_stock_threshold=$8,
+				version = version + 1
+			WHERE id=$9 AND ($10::int IS NULL OR version=$10) RETURNING *)
+		SELECT ` + ProductColumns + " FROM p " + SaleJoin
+	err = ScanProduct(tx.QueryRowContext(ctx, query, p.SKU, p.Name, p.Description, p.Price, p.Category, p.TaxClass, p.Weight, p.LowStockThreshold,
+		p.ID, version, keepSKU), p)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM products WHERE id=$1)", p.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrProductNotFound
+		}
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return skuError(err)
+	}
+	// the UPDATE holds the product lock that schedule changes take, so no
+	// window can be saved between this check and the commit
+	var undercut bool
+	query = `SELECT EXISTS (SELECT 1 FROM product_prices WHERE product_id=$1 AND compare_at_price IS NULL AND sale_price >= $2
+		AND (ends_at IS NULL OR ends_at > NOW()))`
+	if err := tx.QueryRowContext(ctx, query, p.ID, p.Price).Scan(&undercut); err != nil {
+		return err
+	}
+	if undercut {
+		return ErrPriceBelowSale
+	}
+	if err := recordProductEvent(ctx, tx, events.ProductUpdated, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ArchiveProduct takes a product off the storefront without deleting it, so
+// orders, reviews and the stock ledger keep their history. It is dropped from
+// carts; wishlists keep it hidden until it is restored. Archiving an archived
+// product is a no-op.
+func ArchiveProduct(ctx context.Context, productID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var archived bool
+	err = tx.QueryRowContext(ctx, "SELECT archived_at IS NOT NULL FROM products WHERE id=$1 FOR UPDATE", productID).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return ErrProductNotFound
+	}
+	if err != nil || archived {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET archived_at=NOW() WHERE id=$1", productID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cart WHERE product_id=$1", productID); err != nil {
+		return err
+	}
+	if err := events.Record(ctx, tx, events.ProductArchived, "product", productID, productRef{ID: productID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreProduct puts an archived product back on the storefront
+func RestoreProduct(ctx context.Context, productID int) (*models.Products, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var archived bool
+	err = tx.QueryRowContext(ctx, "SELECT archived_at IS NOT NULL FROM products WHERE id=$1 FOR UPDATE", productID).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p models.Products
+	query := "WITH p AS (UPDATE products SET archived_at=NULL WHERE id=$1 RETURNING *) SELECT " + ProductColumns + " FROM p " + SaleJoin
+	if err := ScanProduct(tx.QueryRowContext(ctx, query, productID), &p); err != nil {
+		return nil, err
+	}
+	// restoring a product that is not archived changes nothing, so announces nothing
+	if archived {
+		if err := events.Record(ctx, tx, events.ProductRestored, "product", productID, productRef{ID: productID}); err != nil {
+			return nil, err
+		}
+	}
+	return &p, tx.Commit()
+}
+
+type productRef struct {
+	ID int `json:"id"`
+}
+
+// recordProductEvent records a product.created or product.updated event
+// carrying p and remembers its effective price as the one last announced
+func recordProductEvent(ctx context.Context, tx *sql.Tx, eventType string, p *models.Products) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET announced_price=$2 WHERE id=$1", p.ID, p.EffectivePrice); err != nil {
+		return err
+	}
+	return events.Record(ctx, tx, eventType, "product", p.ID, p)
+}
+
+// normalizeSKU stores a blank SKU as NULL, since only non-null SKUs have to be unique
+func normalizeSKU(p *models.Products) {
+	if p.SKU != nil && strings.TrimSpace(*p.SKU) == "" {
+		p.SKU = nil
+	}
+}
+
+func skuError(err error) error {
+	if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return ErrDuplicateSKU
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database/dbtest"
+	"e-commerce/events"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// productRow is a ProductColumns row for product id with the given list and
+// effective prices
+func productRow(id int64, price, effective float64) []driver.Value {
+	return []driver.Value{id, nil, "Lamp", "", price, effective, nil, nil, nil,
+		int64(5), "home", DefaultTaxClass, 1.5, nil, int64(0), 0.0, nil, int64(3), time.Now()}
+}
+
+func TestRestoreProductAnnouncesOnlyArchivedProducts(t *testing.T) {
+	for _, archived := range []bool{true, false} {
+		db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "SELECT archived_at IS NOT NULL"):
+				return dbtest.Row(archived)
+			case strings.Contains(query, "UPDATE products SET archived_at=NULL"):
+				return dbtest.Result{Rows: [][]driver.Value{productRow(4, 20, 20)}}
+			}
+			return dbtest.Result{RowsAffected: 1}
+		})
+
+		if _, err := RestoreProduct(context.Background(), 4); err != nil {
+			t.Fatalf("archived=%v: %v", archived, err)
+		}
+		recorded := db.Ran("INSERT INTO outbox_events")
+		if archived && (len(recorded) != 1 || recorded[0].Args[0] != events.ProductRestored) {
+			t.Errorf("restoring an archived product recorded %v, want product.restored", recorded)
+		}
+		if !archived && len(recorded) != 0 {
+			t.Errorf("restoring a live product recorded %v", recorded)
+		}
+	}
+}
+
+func TestUpdateProductKeepsListPriceAboveSales(t *testing.T) {
+	for _, undercut := range []bool{true, false} {
+		db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "UPDATE products SET sku"):
+				return dbtest.Result{Rows: [][]driver.Value{productRow(4, 10, 10)}}
+			case strings.Contains(query, "compare_at_price IS NULL"):
+				return dbtest.Row(undercut)
+			}
+			return dbtest.Result{RowsAffected: 1}
+		})
+
+		p := models.Products{ID: 4, Name: "Lamp", Price: 10, TaxClass: DefaultTaxClass}
+		err := UpdateProduct(context.Background(), &p, nil, true)
+		if undercut && !errors.Is(err, ErrPriceBelowSale) {
+			t.Errorf("list price under a sale: err = %v, want ErrPriceBelowSale", err)
+		}
+		if !undercut && err != nil {
+			t.Errorf("list price above every sale: %v", err)
+		}
+		if committed := len(db.Ran("COMMIT")) == 1; committed == undercut {
+			t.Errorf("undercut = %v but committed = %v", undercut, committed)
+		}
+		if checks := db.Ran("compare_at_price IS NULL"); len(checks) != 1 || checks[0].Args[1] != 10.0 {
+			t.Errorf("sale check ran as %v, want one check against price 10", checks)
+		}
+	}
+}
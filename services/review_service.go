@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/models"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrReviewNotFound   = errors.New("review not found")
+	ErrNotVerifiedBuyer = errors.New("only customers with a delivered order for this product can review it")
+	ErrAlreadyReviewed  = errors.New("you have already reviewed this product")
+)
+
+// RatingColumns selects a product's approved review count and average, for
+// appending to a products column list
+const RatingColumns = "rating_count, COALESCE(ROUND(rating_sum::numeric / NULLIF(rating_count, 0), 2), 0)::float8"
+
+const reviewColumns = "r.id, r.product_id, r.user_id, u.username, r.rating, r.title, r.body, r.status, r.created_at"
+
+func scanReview(row interface{ Scan(...interface{}) error }, r *models.Review) error {
+	return row.Scan(&r.ID, &r.ProductID, &r.UserID, &r.Username, &r.Rating, &r.Title, &r.Body, &r.Status, &r.CreatedAt)
+}
+
+// CreateReview stores a review for moderation. Only a user with a delivered
+// order containing the product may review it, once.
+func CreateReview(ctx context.Context, r *models.Review) error {
+	var exists, verified bool
+	query := `SELECT EXISTS (SELECT 1 FROM products WHERE id=$2 AND archived_at IS NULL),
+		EXISTS (SELECT 1 FROM orders o JOIN order_items oi ON oi.order_id = o.id
+			WHERE o.user_id=$1 AND oi.product_id=$2 AND o.status='Delivered')`
+	if err := database.DB.QueryRowContext(ctx, query, r.UserID, r.ProductID).Scan(&exists, &verified); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrProductNotFound
+	}
+	if !verified {
+		return ErrNotVerifiedBuyer
+	}
+
+	query = `INSERT INTO reviews (product_id, user_id, rating, title, body) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at, (SELECT username FROM users WHERE id=$2)`
+	err := database.DB.QueryRowContext(ctx, query, r.ProductID, r.UserID, r.Rating, r.Title, r.Body).
+		Scan(&r.ID, &r.Status, &r.CreatedAt, &r.Username)
+	if err != nil && strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+		return ErrAlreadyReviewed
+	}
+	return err
+}
+
+// ProductReviews returns the approved reviews of a product, newest first
+func ProductReviews(ctx context.Context, productID, limit int) ([]models.Review, error) {
+	query := "SELECT " + reviewColumns + ` FROM reviews r JOIN users u ON u.id = r.user_id
+		WHERE r.product_id=$1 AND r.status='approved' ORDER BY r.created_at DESC LIMIT $2`
+	return queryReviews(ctx, database.Reader(), query, productID, limit)
+}
+
+// ReviewsByStatus lists reviews in a moderation state, oldest first so the
+// queue is worked in order
+func ReviewsByStatus(ctx context.Context, status string, limit int) ([]models.Review, error) {
+	query := "SELECT " + reviewColumns + ` FROM reviews r JOIN users u ON u.id = r.user_id
+		WHERE r.status=$1 ORDER BY r.created_at LIMIT $2`
+	return queryReviews(ctx, database.DB, query, status, limit)
+}
+
+func queryReviews(ctx context.Context, q database.Querier, query string, args ...interface{}) ([]models.Review, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var r models.Review
+		if err := scanReview(rows, &r); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// SetReviewStatus moves a review between moderation states and adjusts the
+// product's rating totals when it enters or leaves "approved"
+func SetReviewStatus(ctx context.Context, reviewID int, status string) (*models.Review, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM reviews WHERE id=$1 FOR UPDATE", reviewID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE reviews SET status=$1, updated_at=NOW() WHERE id=$2", status, reviewID); err != nil {
+		return nil, err
+	}
+	var review models.Review
+	query := "SELECT " + reviewColumns + " FROM reviews r JOIN users u ON u.id = r.user_id WHERE r.id=$1"
+	if err := scanReview(tx.QueryRowContext(ctx, query, reviewID), &review); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case previous != models.ReviewApproved && status == models.ReviewApproved:
+		err = adjustRating(ctx, tx, review.ProductID, review.Rating, 1)
+	case previous == models.ReviewApproved && status != models.ReviewApproved:
+		err = adjustRating(ctx, tx, review.ProductID, -review.Rating, -1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &review, tx.Commit()
+}
+
+// DeleteReview removes a review, taking it out of the rating if it was approved
+func DeleteReview(ctx context.Context, reviewID int) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var productID, rating int
+	var status string
+	err = tx.QueryRowContext(ctx, "DELETE FROM reviews WHERE id=$1 RETURNING product_id, rating, status", reviewID).
+		Scan(&productID, &rating, &status)
+	if err == sql.ErrNoRows {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == models.ReviewApproved {
+		if err := adjustRating(ctx, tx, productID, -rating, -1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// adjustRating applies a delta to the product's running totals; the row lock
+// taken by the update keeps concurrent moderation from losing an update
+func adjustRating(ctx context.Context, q database.Querier, productID, sum, count int) error {
+	_, err := q.ExecContext(ctx, "UPDATE products SET rating_sum = rating_sum + $1, rating_count = rating_count + $2 WHERE id=$3",
+		sum, count, productID)
+	return err
+}
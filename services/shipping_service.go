@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/models"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrShippingMethodUnavailable = errors.New("shipping method is not available for this cart")
+	ErrOrderNotShippable         = errors.New("order cannot be shipped in its current status")
+	ErrNothingToShip             = errors.New("every item in this order has already shipped")
+	ErrInvalidShipment           = errors.New("invalid shipment")
+)
+
+// shippableStatuses are the order states from which goods may leave the warehouse
+var shippableStatuses = map[string]bool{
+	"Paid":              true,
+	"Pending":           true,
+	"Partially Shipped": true,
+}
+
+// CartWeight is the total weight of the lines in kg
+func CartWeight(lines []LineItem) float64 {
+	var weight float64
+	for _, line := range lines {
+		weight += line.Weight * float64(line.Quantity)
+	}
+	return weight
+}
+
+// ShippingOptions lists every active method with a rate matching the cart's
+// weight and subtotal, using each method's cheapest matching rate. A free
+// shipping coupon zeroes the price but keeps the choice of method.
+func ShippingOptions(ctx context.Context, q database.Querier, weight, subtotal float64, freeShipping bool) ([]models.ShippingOption, error) {
+	query := `SELECT DISTINCT ON (m.id) m.id, m.code, m.name, m.carrier, r.price
+		FROM shipping_methods m JOIN shipping_rates r ON r.method_id = m.id
+		WHERE m.active
+			AND $1 >= r.min_weight AND (r.max_weight IS NULL OR $1 < r.max_weight)
+			AND $2 >= r.min_subtotal AND (r.max_subtotal IS NULL OR $2 < r.max_subtotal)
+		ORDER BY m.id, r.price`
+	rows, err := q.QueryContext(ctx, query, weight, subtotal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []models.ShippingOption{}
+	for rows.Next() {
+		var option models.ShippingOption
+		if err := rows.Scan(&option.MethodID, &option.Code, &option.Name, &option.Carrier, &option.Price); err != nil {
+			return nil, err
+		}
+		if freeShipping {
+			option.Price = 0
+		}
+		options = append(options, option)
+	}
+	return options, rows.Err()
+}
+
+// SelectShippingOption picks the requested method, or the cheapest one when none
+// is requested. It returns nil when no methods are configured at all, so stores
+// without shipping setup still check out with no shipping charge.
+func SelectShippingOption(ctx context.Context, q database.Querier, lines []LineItem, subtotal float64, freeShipping bool, methodID *int) (*models.ShippingOption, error) {
+	options, err := ShippingOptions(ctx, q, CartWeight(lines), subtotal, freeShipping)
+	if err != nil {
+		return nil, err
+	}
+
+	if methodID == nil {
+		if len(options) == 0 {
+			var configured bool
+			if err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM shipping_methods WHERE active)").Scan(&configured); err != nil {
+				return nil, err
+			}
+			if configured {
+				return nil, ErrShippingMethodUnavailable
+			}
+			return nil, nil
+		}
+		cheapest := options[0]
+		for _, option := range options[1:] {
+			if option.Price < cheapest.Price {
+				cheapest = option
+			}
+		}
+		return &cheapest, nil
+	}
+
+	for _, option := range options {
+		if option.MethodID == *methodID {
+			return &option, nil
+		}
+	}
+	return nil, ErrShippingMethodUnavailable
+}
+
+func CreateShippingMethod(ctx context.Context, m *models.ShippingMethod) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO shipping_methods (code, name, carrier, active) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	if err := tx.QueryRowContext(ctx, query, m.Code, m.Name, m.Carrier, m.Active).Scan(&m.ID, &m.CreatedAt); err != nil {
+		return err
+	}
+
+	for i := range m.Rates {
+		rate := &m.Rates[i]
+		rate.MethodID = m.ID
+		query := `INSERT INTO shipping_rates (method_id, min_weight, max_weight, min_subtotal, max_subtotal, price)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+		err := tx.QueryRowContext(ctx, query, rate.MethodID, rate.MinWeight, rate.MaxWeight, rate.MinSubtotal, rate.MaxSubtotal, rate.Price).
+			Scan(&rate.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func ListShippingMethods(ctx context.Context) ([]models.ShippingMethod, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT id, code, name, carrier, active, created_at FROM shipping_methods ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := []models.ShippingMethod{}
+	byID := map[int]int{}
+	for rows.Next() {
+		m := models.ShippingMethod{Rates: []models.ShippingRate{}}
+		if err := rows.Scan(&m.ID, &m.Code, &m.Name, &m.Carrier, &m.Active, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		byID[m.ID] = len(methods)
+		methods = append(methods, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rateRows, err := database.DB.QueryContext(ctx,
+		"SELECT id, method_id, min_weight, max_weight, min_subtotal, max_subtotal, price FROM shipping_rates ORDER BY method_id, min_weight, min_subtotal")
+	if err != nil {
+		return nil, err
+	}
+	defer rateRows.Close()
+
+	for rateRows.Next() {
+		var rate models.ShippingRate
+		if err := rateRows.Scan(&rate.ID, &rate.MethodID, &rate.MinWeight, &rate.MaxWeight, &rate.MinSubtotal, &rate.MaxSubtotal, &rate.Price); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[rate.MethodID]; ok {
+			methods[i].Rates = append(methods[i].Rates, rate)
+		}
+	}
+	return methods, rateRows.Err()
+}
+
+// CreateShipment records a shipment for some or all of an order's remaining units
+// and moves the order to "Partially Shipped" or "Shipped" accordingly. It returns
+// the shipment and the order's new status.
+func CreateShipment(ctx context.Context, orderID int, req models.ShipmentRequest) (*models.Shipment, string, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	// lock the order so concurrent shipments can't both ship the same units
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id=$1 FOR UPDATE", orderID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !shippableStatuses[status] {
+		return nil, "", ErrOrderNotShippable
+	}
+
+	remaining, err := unshippedQuantities(ctx, tx, orderID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	items := req.Items
+	if len(items) == 0 {
+		for itemID, qty := range remaining {
+			if qty > 0 {
+				items = append(items, models.ShipmentItem{OrderItemID: itemID, Quantity: qty})
+			}
+		}
+		if len(items) == 0 {
+			return nil, "", ErrNothingToShip
+		}
+	}
+
+	requested := map[int]int{}
+	for _, item := range items {
+		requested[item.OrderItemID] += item.Quantity
+	}
+	for itemID, qty := range requested {
+		left, ok := remaining[itemID]
+		if !ok {
+			return nil, "", fmt.Errorf("%w: item %d is not part of this order", ErrInvalidShipment, itemID)
+		}
+		if qty > left {
+			return nil, "", fmt.Errorf("%w: item %d has only %d unit(s) left to ship", ErrInvalidShipment, itemID, left)
+		}
+	}
+
+	shipment := models.Shipment{OrderID: orderID, Carrier: req.Carrier, TrackingNumber: req.TrackingNumber}
+	query := "INSERT INTO shipments (order_id, carrier, tracking_number) VALUES ($1, $2, $3) RETURNING id, shipped_at"
+	if err := tx.QueryRowContext(ctx, query, orderID, shipment.Carrier, shipment.TrackingNumber).Scan(&shipment.ID, &shipment.ShippedAt); err != nil {
+		return nil, "", err
+	}
+
+	fullyShipped := true
+	for itemID, left := range remaining {
+		qty := requested[itemID]
+		if qty > 0 {
+			_, err := tx.ExecContext(ctx, "INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES ($1, $2, $3)",
+				shipment.ID, itemID, qty)
+			if err != nil {
+				return nil, "", err
+			}
+			shipment.Items = append(shipment.Items, models.ShipmentItem{OrderItemID: itemID, Quantity: qty})
+		}
+		if qty < left {
+			fullyShipped = false
+		}
+	}
+
+	newStatus := "Partially Shipped"
+	if fullyShipped {
+		newStatus = "Shipped"
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status=$1 WHERE id=$2", newStatus, orderID); err != nil {
+		return nil, "", err
+	}
+	if err := events.RecordStatusChange(ctx, tx, orderID, status, newStatus); err != nil {
+		return nil, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return &shipment, newStatus, nil
+}
+
+// unshippedQuantities maps each order item to the units not yet in any shipment
+func unshippedQuantities(ctx context.Context, q database.Querier, orderID int) (map[int]int, error) {
+	query := `SELECT oi.id, oi.quantity - COALESCE(SUM(si.quantity), 0)
+		FROM order_items oi LEFT JOIN shipment_items si ON si.order_item_id = oi.id
+		WHERE oi.order_id=$1 GROUP BY oi.id, oi.quantity`
+	rows, err := q.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	remaining := map[int]int{}
+	for rows.Next() {
+		var itemID, qty int
+		if err := rows.Scan(&itemID, &qty); err != nil {
+			return nil, err
+		}
+		remaining[itemID] = qty
+	}
+	return remaining, rows.Err()
+}
+
+// OrderShipments lists an order's shipments with their items
+func OrderShipments(ctx context.Context, q database.Querier, orderID int) ([]models.Shipment, error) {
+	query := `SELECT s.id, s.order_id, s.carrier, s.tracking_number, s.shipped_at, si.order_item_id, si.quantity
+		FROM shipments s JOIN shipment_items si ON si.shipment_id = s.id
+		WHERE s.order_id=$1 ORDER BY s.id, si.order_item_id`
+	rows, err := q.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shipments := []models.Shipment{}
+	for rows.Next() {
+		var s models.Shipment
+		var item models.ShipmentItem
+		if err := rows.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.TrackingNumber, &s.ShippedAt, &item.OrderItemID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		if n := len(shipments); n == 0 || shipments[n-1].ID != s.ID {
+			shipments = append(shipments, s)
+		}
+		last := &shipments[len(shipments)-1]
+		last.Items = append(last.Items, item)
+	}
+	return shipments, rows.Err()
+}
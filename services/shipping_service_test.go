@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectShippingOption(t *testing.T) {
+	standard, express, missing := 1, 2, 3
+	matching := dbtest.Result{Rows: [][]driver.Value{
+		{int64(1), "standard", "Standard", "Royal Mail", 4.5},
+		{int64(2), "express", "Express", "DHL", 12.0},
+	}}
+
+	tests := []struct {
+		name       string
+		options    dbtest.Result
+		configured bool
+		free       bool
+		methodID   *int
+		wantMethod int
+		wantPrice  float64
+		wantErr    error
+	}{
+		{"cheapest by default", matching, true, false, nil, 1, 4.5, nil},
+		{"requested method", matching, true, false, &express, 2, 12.0, nil},
+		{"free shipping keeps the requested method", matching, true, true, &express, 2, 0, nil},
+		{"requested method has no matching rate", matching, true, false, &missing, 0, 0, ErrShippingMethodUnavailable},
+		{"no rate matches the cart", dbtest.Result{}, true, false, nil, 0, 0, ErrShippingMethodUnavailable},
+		{"no methods configured", dbtest.Result{}, false, false, nil, 0, 0, nil},
+		{"requested method without any rates", dbtest.Result{}, true, false, &standard, 0, 0, ErrShippingMethodUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "FROM shipping_methods m JOIN shipping_rates"):
+					return tt.options
+				case strings.Contains(query, "SELECT EXISTS"):
+					return dbtest.Row(tt.configured)
+				}
+				return dbtest.Result{}
+			})
+
+			lines := []LineItem{{Weight: 1.5, Quantity: 2}, {Weight: 0.5, Quantity: 1}}
+			option, err := SelectShippingOption(context.Background(), database.DB, lines, 80, tt.free, tt.methodID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SelectShippingOption error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMethod == 0 {
+				if option != nil {
+					t.Errorf("option = %+v, want none", option)
+				}
+			} else if option == nil || option.MethodID != tt.wantMethod || option.Price != tt.wantPrice {
+				t.Errorf("option = %+v, want method %d at %.2f", option, tt.wantMethod, tt.wantPrice)
+			}
+
+			rates := db.Ran("FROM shipping_methods m JOIN shipping_rates")
+			if len(rates) != 1 || rates[0].Args[0] != 3.5 || rates[0].Args[1] != 80.0 {
+				t.Errorf("rate lookup = %+v, want weight 3.5 and subtotal 80", rates)
+			}
+		})
+	}
+}
+
+func TestCreateShipmentLimitsQuantities(t *testing.T) {
+	// order item 10 has 2 units left to ship and item 11 has 1
+	remaining := dbtest.Result{Rows: [][]driver.Value{{int64(10), int64(2)}, {int64(11), int64(1)}}}
+	shipped := dbtest.Result{Rows: [][]driver.Value{{int64(10), int64(0)}, {int64(11), int64(0)}}}
+
+	tests := []struct {
+		name       string
+		status     string
+		remaining  dbtest.Result
+		items      []models.ShipmentItem
+		wantStatus string
+		wantItems  int
+		wantErr    error
+	}{
+		{"everything left by default", "Paid", remaining, nil, "Shipped", 2, nil},
+		{"part of an item", "Paid", remaining, []models.ShipmentItem{{OrderItemID: 10, Quantity: 1}}, "Partially Shipped", 1, nil},
+		{"rest of a partially shipped order", "Partially Shipped", remaining,
+			[]models.ShipmentItem{{OrderItemID: 10, Quantity: 2}, {OrderItemID: 11, Quantity: 1}}, "Shipped", 2, nil},
+		{"more units than are left", "Paid", remaining, []models.ShipmentItem{{OrderItemID: 10, Quantity: 3}}, "", 0, ErrInvalidShipment},
+		{"repeated item adds up past what is left", "Paid", remaining,
+			[]models.ShipmentItem{{OrderItemID: 10, Quantity: 1}, {OrderItemID: 10, Quantity: 2}}, "", 0, ErrInvalidShipment},
+		{"item from another order", "Paid", remaining, []models.ShipmentItem{{OrderItemID: 99, Quantity: 1}}, "", 0, ErrInvalidShipment},
+		{"everything already shipped", "Partially Shipped", shipped, nil, "", 0, ErrNothingToShip},
+		{"cancelled order", "Cancelled", remaining, nil, "", 0, ErrOrderNotShippable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT status FROM orders"):
+					return dbtest.Row(tt.status)
+				case strings.Contains(query, "FROM order_items oi LEFT JOIN shipment_items"):
+					return tt.remaining
+				case strings.Contains(query, "INSERT INTO shipments"):
+					return dbtest.Row(int64(5), time.Now())
+				}
+				return dbtest.Result{RowsAffected: 1}
+			})
+
+			req := models.ShipmentRequest{Carrier: "DHL", TrackingNumber: "JD0001", Items: tt.items}
+			shipment, status, err := CreateShipment(context.Background(), 40, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateShipment error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(db.Ran("INSERT INTO shipments")) != 0 || len(db.Ran("COMMIT")) != 0 {
+					t.Errorf("calls = %+v, want no shipment recorded", db.Calls())
+				}
+				return
+			}
+
+			if status != tt.wantStatus || shipment.ID != 5 || len(shipment.Items) != tt.wantItems {
+				t.Errorf("shipment %+v status %q, want id 5 with %d item(s) and status %q", shipment, status, tt.wantItems, tt.wantStatus)
+			}
+			if got := len(db.Ran("INSERT INTO shipment_items")); got != tt.wantItems {
+				t.Errorf("inserted %d shipment item(s), want %d", got, tt.wantItems)
+			}
+			update := db.Ran("UPDATE orders SET status")
+			if len(update) != 1 || update[0].Args[0] != tt.wantStatus {
+				t.Errorf("status update = %+v, want %q", update, tt.wantStatus)
+			}
+			if len(db.Ran("COMMIT")) != 1 {
+				t.Error("transaction not committed")
+			}
+		})
+	}
+}
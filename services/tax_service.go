@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"e-commerce/database"
+	"strings"
+)
+
+const DefaultTaxClass = "standard"
+
+// TaxAddress is the part of a shipping address that decides the tax jurisdiction
+type TaxAddress struct {
+	Country    string
+	Region     string
+	PostalCode string
+}
+
+// TaxRateProvider resolves the rate for a product tax class at an address.
+// Rates are fractions, so 0.0825 means 8.25%. q is the checkout transaction;
+// providers that read the database must use it rather than take a second
+// connection from the pool while checkout holds one.
+type TaxRateProvider interface {
+	Rate(ctx context.Context, q database.Querier, address TaxAddress, taxClass string) (float64, error)
+}
+
+// TaxProvider is the rate source used at checkout. It defaults to the local
+// tax_rates table; an external service can be installed in its place.
+var TaxProvider TaxRateProvider = TableRateProvider{}
+
+// TableRateProvider reads rates from the tax_rates table. A region-specific row
+// wins over the country-wide row (region ''); no matching row means no tax.
+type TableRateProvider struct{}
+
+func (TableRateProvider) Rate(ctx context.Context, q database.Querier, address TaxAddress, taxClass string) (float64, error) {
+	query := `SELECT rate FROM tax_rates
+		WHERE country=$1 AND tax_class=$2 AND (region=$3 OR region='')
+		ORDER BY region DESC LIMIT 1`
+	var rate float64
+	err := q.QueryRowContext(ctx, query, strings.ToUpper(address.Country), taxClass, strings.ToUpper(address.Region)).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return rate, err
+}
+
+// CalculateTax sets Tax on every line from its discounted amount and returns the
+// order's total tax. Each tax class is looked up once per order.
+func CalculateTax(ctx context.Context, q database.Querier, address TaxAddress, lines []LineItem) (float64, error) {
+	rates := map[string]float64{}
+	var total float64
+	for i := range lines {
+		class := lines[i].TaxClass
+		if class == "" {
+			class = DefaultTaxClass
+		}
+		rate, ok := rates[class]
+		if !ok {
+			var err error
+			rate, err = TaxProvider.Rate(ctx, q, address, class)
+			if err != nil {
+				return 0, err
+			}
+			rates[class] = rate
+		}
+
+		lines[i].Tax = roundCents(lines[i].Total() * rate)
+		total += lines[i].Tax
+	}
+	return roundCents(total), nil
+}
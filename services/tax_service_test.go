@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/database"
+	"e-commerce/database/dbtest"
+	"testing"
+)
+
+func TestCalculateTaxRoundsEachLine(t *testing.T) {
+	db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if args[1] == "reduced" {
+			return dbtest.Row(0.05)
+		}
+		return dbtest.Row(0.0825)
+	})
+	lines := []LineItem{
+		{ProductID: 1, Quantity: 1, UnitPrice: 0.10},
+		{ProductID: 2, Quantity: 1, UnitPrice: 0.10, TaxClass: DefaultTaxClass},
+		{ProductID: 3, Quantity: 1, UnitPrice: 0.10},
+		{ProductID: 4, Quantity: 3, UnitPrice: 10, Discount: 5, TaxClass: "reduced"},
+	}
+
+	total, err := CalculateTax(context.Background(), database.DB, TaxAddress{Country: "us", Region: "tx"}, lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0.00825 rounds up to a cent on each line; taxing the 0.30 sum would give 0.02
+	for i, want := range []float64{0.01, 0.01, 0.01, 1.25} {
+		if lines[i].Tax != want {
+			t.Errorf("line %d tax = %v, want %v", i, lines[i].Tax, want)
+		}
+	}
+	if total != 1.28 {
+		t.Errorf("total tax = %v, want 1.28", total)
+	}
+
+	lookups := db.Ran("FROM tax_rates")
+	if len(lookups) != 2 {
+		t.Fatalf("looked up %d rates, want one per class", len(lookups))
+	}
+	if lookups[0].Args[0] != "US" || lookups[0].Args[2] != "TX" {
+		t.Errorf("rate looked up for %v, want the upper-cased address", lookups[0].Args)
+	}
+}
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"e-commerce/config"
+	"e-commerce/database"
+	"e-commerce/events"
+	"e-commerce/jobs"
+	"e-commerce/logging"
+	"e-commerce/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeliverWebhookJob is the job kind that sends one webhook delivery
+const DeliverWebhookJob = "webhooks.deliver"
+
+// Webhook request headers. The signature header is "t=<unix seconds>,v1=<hex>",
+// where v1 is the HMAC-SHA256 of "<t>.<body>" keyed with the subscription secret.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const maxLoggedResponse = 2048
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrDeliveryInProgress rejects a redelivery while the delivery is still queued or being retried
+	ErrDeliveryInProgress = errors.New("webhook delivery is still in progress")
+)
+
+var webhookConfig = config.WebhooksConfig{MaxAttempts: 8, Timeout: 10 * time.Second}
+
+var webhookClient = &http.Client{Timeout: webhookConfig.Timeout}
+
+// ConfigureWebhooks sets the delivery attempt limit and request timeout
+func ConfigureWebhooks(cfg config.WebhooksConfig) {
+	webhookConfig = cfg
+	webhookClient = &http.Client{Timeout: cfg.Timeout}
+}
+
+// SignWebhook returns the signature header value for body sent at timestamp.
+// Receivers recompute it with their copy of the secret and compare in constant time.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookSecret generates a random signing secret
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+const webhookColumns = "id, url, event_types, secret, active, created_at"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }, s *models.WebhookSubscription) error {
+	var eventTypes []byte
+	if err := row.Scan(&s.ID, &s.URL, &eventTypes, &s.Secret, &s.Active, &s.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(eventTypes, &s.EventTypes)
+}
+
+func CreateWebhook(ctx context.Context, s *models.WebhookSubscription) error {
+	eventTypes, err := json.Marshal(s.EventTypes)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO webhook_subscriptions (url, event_types, secret, active) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
+	return database.DB.QueryRowContext(ctx, query, s.URL, eventTypes, s.Secret, s.Active).Scan(&s.ID, &s.CreatedAt)
+}
+
+// UpdateWebhook replaces a subscription's settings; an empty secret keeps the current one
+func UpdateWebhook(ctx context.Context, s *models.WebhookSubscription) error {
+	eventTypes, err := json.Marshal(s.EventTypes)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE webhook_subscriptions SET url=$1, event_types=$2, secret=COALESCE(NULLIF($3, ''), secret), active=$4
+		WHERE id=$5 RETURNING ` + webhookColumns
+	err = scanWebhook(database.DB.QueryRowContext(ctx, query, s.URL, eventTypes, s.Secret, s.Active, s.ID), s)
+	if err == sql.ErrNoRows {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func DeleteWebhook(ctx context.Context, id int) error {
+	res, err := database.DB.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var s models.WebhookSubscription
+		if err := scanWebhook(rows, &s); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// WebhookSink fans committed domain events out to matching subscriptions. It
+// only records a delivery and queues a job per subscription, so one slow
+// receiver never holds up the outbox relay. Relaying the same event twice is
+// harmless: the delivery is unique per subscription and event.
+type WebhookSink struct{}
+
+func (WebhookSink) Name() string { return "webhooks" }
+
+func (WebhookSink) Publish(ctx context.Context, e events.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1, $2, $3 FROM webhook_subscriptions
+		WHERE active AND (event_types ?| $4::text[] OR event_types @> '["*"]')
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+		RETURNING id`
+	rows, err := tx.QueryContext(ctx, query, e.ID, e.Type, payload, events.Names(e.Type))
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := enqueueDelivery(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type deliveryJob struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+func enqueueDelivery(ctx context.Context, q database.Querier, deliveryID int64) error {
+	// the delivery tracks its own attempts; the extra job attempt only covers
+	// failures to record the outcome
+	_, err := jobs.Enqueue(ctx, q, jobs.NewJob{
+		Kind:        DeliverWebhookJob,
+		Payload:     deliveryJob{DeliveryID: deliveryID},
+		MaxAttempts: webhookConfig.MaxAttempts + 1,
+		UniqueKey:   fmt.Sprintf("webhook-delivery:%d", deliveryID),
+	})
+	return err
+}
+
+// DeliverWebhook is the job handler for DeliverWebhookJob. A failed attempt
+// returns an error so the job queue retries it with backoff, until the delivery
+// has used WEBHOOK_MAX_ATTEMPTS and is marked failed.
+func DeliverWebhook(ctx context.Context, raw json.RawMessage) error {
+	var job deliveryJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return err
+	}
+
+	var d models.WebhookDelivery
+	var url, secret string
+	query := `SELECT d.id, d.event_type, d.payload, d.status, d.attempts, s.url, s.secret
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.id=$1`
+	err := database.DB.QueryRowContext(ctx, query, job.DeliveryID).Scan(&d.ID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &url, &secret)
+	if err == sql.ErrNoRows {
+		return nil // the subscription was deleted along with its deliveries
+	}
+	if err != nil {
+		return err
+	}
+	if d.Status == models.DeliverySucceeded || d.Status == models.DeliveryFailed {
+		return nil
+	}
+
+	status, body, sendErr := sendWebhook(ctx, url, secret, &d)
+	d.Attempts++
+
+	outcome := models.DeliverySucceeded
+	if sendErr != nil {
+		outcome = models.DeliveryRetrying
+		if d.Attempts >= webhookConfig.MaxAttempts {
+			outcome = models.DeliveryFailed
+		}
+	}
+	var errText *string
+	if sendErr != nil {
+		msg := sendErr.Error()
+		errText = &msg
+	}
+
+	if err := recordAttempt(ctx, &d, outcome, status, body, errText); err != nil {
+		return err
+	}
+
+	if outcome == models.DeliveryRetrying {
+		return sendErr
+	}
+	if outcome == models.DeliveryFailed {
+		logging.FromContext(ctx).Warn("webhook delivery failed permanently", "delivery_id", d.ID, "url", url, "error", sendErr)
+	}
+	return nil
+}
+
+func sendWebhook(ctx context.Context, url, secret string, d *models.WebhookDelivery) (*int, *string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, time.Now(), d.Payload))
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(d.ID, 10))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedResponse))
+	body := string(snippet)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, &body, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return &resp.StatusCode, &body, nil
+}
+
+// recordAttempt logs one attempt and updates the delivery's current state
+func recordAttempt(ctx context.Context, d *models.WebhookDelivery, outcome string, status *int, body, errText *string) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO webhook_delivery_attempts (delivery_id, response_status, response_body, error) VALUES ($1, $2, $3, $4)",
+		d.ID, status, body, errText)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE webhook_deliveries SET status=$2, attempts=$3, response_status=$4, response_body=$5, error=$6,
+		last_attempt_at=NOW(), delivered_at=CASE WHEN $2 = 'succeeded' THEN NOW() END
+		WHERE id=$1`
+	if _, err := tx.ExecContext(ctx, query, d.ID, outcome, d.Attempts, status, body, errText); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Redeliver queues a finished (succeeded or failed) delivery again with a fresh
+// set of attempts. A delivery still pending or retrying already has a job, and
+// resetting its attempts under that job would send it more than the limit allows.
+func Redeliver(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT status FROM webhook_deliveries WHERE id=$1 FOR UPDATE", deliveryID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status != models.DeliverySucceeded && status != models.DeliveryFailed {
+		return nil, ErrDeliveryInProgress
+	}
+
+	query := "UPDATE webhook_deliveries SET status='pending', attempts=0 WHERE id=$1 RETURNING " + deliveryColumns
+	var d models.WebhookDelivery
+	if err := scanDelivery(tx.QueryRowContext(ctx, query, deliveryID), &d); err != nil {
+		return nil, err
+	}
+	if err := enqueueDelivery(ctx, tx, deliveryID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, response_status, response_body,
+	error, last_attempt_at, delivered_at, created_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }, d *models.WebhookDelivery) error {
+	return row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus,
+		&d.ResponseBody, &d.Error, &d.LastAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+}
+
+// WebhookDeliveries lists a subscription's deliveries, newest first
+func WebhookDeliveries(ctx context.Context, subscriptionID, limit int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	if err := database.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM webhook_subscriptions WHERE id=$1)", subscriptionID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE subscription_id=$1 ORDER BY id DESC LIMIT $2"
+	rows, err := database.DB.QueryContext(ctx, query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// WebhookDelivery loads one delivery with the log of every attempt
+func WebhookDelivery(ctx context.Context, deliveryID int64) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	err := scanDelivery(database.DB.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id=$1", deliveryID), &d)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, response_status, response_body, error, attempted_at FROM webhook_delivery_attempts WHERE delivery_id=$1 ORDER BY id"
+	rows, err := database.DB.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.AttemptLog = []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.ResponseStatus, &a.ResponseBody, &a.Error, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return &d, rows.Err()
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"e-commerce/config"
+	"e-commerce/database/dbtest"
+	"e-commerce/models"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPayload = `{"id":17,"type":"order.created"}`
+
+// webhookReceiver records the requests it gets and answers with status
+func webhookReceiver(t *testing.T, status int) (url string, received *[]*http.Request, bodies *[]string) {
+	t.Helper()
+	var reqs []*http.Request
+	var payloads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reqs = append(reqs, r)
+		payloads = append(payloads, string(body))
+		w.WriteHeader(status)
+		w.Write([]byte("ack"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &reqs, &payloads
+}
+
+// deliveryDB answers DeliverWebhook's lookup with a delivery to url that has
+// already used attempts
+func deliveryDB(t *testing.T, url string, attempts int64) *dbtest.DB {
+	return dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+		if strings.Contains(query, "FROM webhook_deliveries d JOIN webhook_subscriptions") {
+			return dbtest.Row(int64(381), "order.created", []byte(testPayload), models.DeliveryPending, attempts, url, "whsec_test")
+		}
+		return dbtest.Result{RowsAffected: 1}
+	})
+}
+
+func withWebhookConfig(t *testing.T, cfg config.WebhooksConfig) {
+	previous := webhookConfig
+	ConfigureWebhooks(cfg)
+	t.Cleanup(func() { ConfigureWebhooks(previous) })
+}
+
+func TestDeliverWebhookSignsRequest(t *testing.T) {
+	withWebhookConfig(t, config.WebhooksConfig{MaxAttempts: 3, Timeout: time.Second})
+	url, received, bodies := webhookReceiver(t, http.StatusNoContent)
+	db := deliveryDB(t, url, 0)
+
+	if err := DeliverWebhook(context.Background(), []byte(`{"delivery_id":381}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*received) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(*received))
+	}
+	r := (*received)[0]
+	if (*bodies)[0] != testPayload {
+		t.Errorf("body = %s", (*bodies)[0])
+	}
+	if r.Header.Get(WebhookEventHeader) != "order.created" || r.Header.Get(WebhookDeliveryHeader) != "381" {
+		t.Errorf("headers = %v", r.Header)
+	}
+	sig := r.Header.Get(WebhookSignatureHeader)
+	ts, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(sig, ",")[0], "t="), 10, 64)
+	if err != nil || sig != SignWebhook("whsec_test", time.Unix(ts, 0), []byte(testPayload)) {
+		t.Errorf("signature %q does not verify", sig)
+	}
+
+	updates := db.Ran("UPDATE webhook_deliveries SET status")
+	if len(updates) != 1 || updates[0].Args[1] != models.DeliverySucceeded || updates[0].Args[2] != int64(1) {
+		t.Errorf("recorded %v, want succeeded on attempt 1", updates)
+	}
+}
+
+func TestDeliverWebhookRetriesThenFails(t *testing.T) {
+	withWebhookConfig(t, config.WebhooksConfig{MaxAttempts: 3, Timeout: time.Second})
+	tests := []struct {
+		name     string
+		attempts int64
+		outcome  string
+		wantErr  bool
+	}{
+		{"retried", 1, models.DeliveryRetrying, true},
+		{"out of attempts", 2, models.DeliveryFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, received, _ := webhookReceiver(t, http.StatusInternalServerError)
+			db := deliveryDB(t, url, tt.attempts)
+
+			err := DeliverWebhook(context.Background(), []byte(`{"delivery_id":381}`))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeliverWebhook = %v, want error %v", err, tt.wantErr)
+			}
+			if len(*received) != 1 {
+				t.Fatalf("receiver got %d requests, want 1", len(*received))
+			}
+			updates := db.Ran("UPDATE webhook_deliveries SET status")
+			if len(updates) != 1 || updates[0].Args[1] != tt.outcome || updates[0].Args[3] != int64(500) {
+				t.Errorf("recorded %v, want %s with status 500", updates, tt.outcome)
+			}
+			if len(db.Ran("INSERT INTO webhook_delivery_attempts")) != 1 {
+				t.Error("attempt was not logged")
+			}
+		})
+	}
+}
+
+func TestRedeliverOnlyFinishedDeliveries(t *testing.T) {
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{models.DeliveryFailed, nil},
+		{models.DeliverySucceeded, nil},
+		{models.DeliveryPending, ErrDeliveryInProgress},
+		{models.DeliveryRetrying, ErrDeliveryInProgress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db := dbtest.New(t, func(query string, args []driver.Value) dbtest.Result {
+				switch {
+				case strings.Contains(query, "SELECT status FROM webhook_deliveries"):
+					return dbtest.Row(tt.status)
+				case strings.Contains(query, "UPDATE webhook_deliveries"):
+					return dbtest.Row(int64(381), int64(2), int64(17), "order.created", []byte(testPayload), models.DeliveryPending,
+						int64(0), nil, nil, nil, nil, nil, time.Now())
+				case strings.Contains(query, "INSERT INTO jobs"):
+					return dbtest.Row(int64(50))
+				}
+				return dbtest.Result{}
+			})
+
+			_, err := Redeliver(context.Background(), 381)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Redeliver = %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(db.Ran("SELECT status")[0].Query, "FOR UPDATE") {
+				t.Error("status was not read under a row lock")
+			}
+			reset, queued := len(db.Ran("UPDATE webhook_deliveries")), len(db.Ran("INSERT INTO jobs"))
+			if tt.want == nil && (reset != 1 || queued != 1) {
+				t.Errorf("reset %d and queued %d, want one of each", reset, queued)
+			}
+			if tt.want != nil && (reset != 0 || queued != 0) {
+				t.Errorf("reset %d and queued %d for a delivery in progress", reset, queued)
+			}
+		})
+	}
+}
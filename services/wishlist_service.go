@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"e-commerce/database"
+	"e-commerce/models"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrWishlistNotFound     = errors.New("wishlist not found")
+	ErrWishlistItemNotFound = errors.New("product not found in wishlist")
+	ErrNotInCart            = errors.New("product not found in cart")
+)
+
+// archived products stay on wishlists but are hidden until restored
+const wishlistColumns = `w.id, w.user_id, w.name, w.share_token, w.created_at,
+	(SELECT COUNT(*) FROM wishlist_items i JOIN products p ON p.id = i.product_id
+		WHERE i.wishlist_id = w.id AND p.archived_at IS NULL)`
+
+func scanWishlist(row interface{ Scan(...interface{}) error }, w *models.Wishlist) error {
+	return row.Scan(&w.ID, &w.UserID, &w.Name, &w.ShareToken, &w.CreatedAt, &w.ItemCount)
+}
+
+// ownWishlist checks that the list exists and belongs to the user
+func ownWishlist(ctx context.Context, q database.Querier, userID, wishlistID int) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM wishlists WHERE id=$1 AND user_id=$2)", wishlistID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+func ListWishlists(ctx context.Context, userID int) ([]models.Wishlist, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT "+wishlistColumns+" FROM wishlists w WHERE w.user_id=$1 ORDER BY w.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []models.Wishlist{}
+	for rows.Next() {
+		var w models.Wishlist
+		if err := scanWishlist(rows, &w); err != nil {
+			return nil, err
+		}
+		lists = append(lists, w)
+	}
+	return lists, rows.Err()
+}
+
+// GetWishlist returns one of the user's lists with its items
+func GetWishlist(ctx context.Context, userID, wishlistID int) (*models.Wishlist, error) {
+	var w models.Wishlist
+	query := "SELECT " + wishlistColumns + " FROM wishlists w WHERE w.id=$1 AND w.user_id=$2"
+	return withItems(ctx, &w, scanWishlist(database.DB.QueryRowContext(ctx, query, wishlistID, userID), &w))
+}
+
+// SharedWishlist returns a shared list by its token, without the owner
+func SharedWishlist(ctx context.Context, token string) (*models.Wishlist, error) {
+	var w models.Wishlist
+	query := "SELECT " + wishlistColumns + " FROM wishlists w WHERE w.share_token=$1"
+	list, err := withItems(ctx, &w, scanWishlist(database.Reader().QueryRowContext(ctx, query, token), &w))
+	if err != nil {
+		return nil, err
+	}
+	list.UserID = 0
+	return list, nil
+}
+
+func withItems(ctx context.Context, w *models.Wishlist, scanErr error) (*models.Wishlist, error) {
+	if scanErr == sql.ErrNoRows {
+		return nil, ErrWishlistNotFound
+	}
+	if scanErr != nil {
+		return nil, scanErr
+	}
+
+	query := `SELECT p.id, p.name, ` + EffectivePrice + `, p.stock > 0, i.added_at
+		FROM wishlist_items i JOIN products p ON p.id = i.product_id ` + SaleJoin + `
+		WHERE i.wishlist_id=$1 AND p.archived_at IS NULL ORDER BY i.added_at`
+	rows, err := database.DB.QueryContext(ctx, query, w.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w.Items = []models.WishlistItem{}
+	for rows.Next() {
+		var item models.WishlistItem
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Price, &item.InStock, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		w.Items = append(w.Items, item)
+	}
+	return w, rows.Err()
+}
+
+func CreateWishlist(ctx context.Context, w *models.Wishlist) error {
+	query := "INSERT INTO wishlists (user_id, name) VALUES ($1, $2) RETURNING id, created_at"
+	return database.DB.QueryRowContext(ctx, query, w.UserID, w.Name).Scan(&w.ID, &w.CreatedAt)
+}
+
+func RenameWishlist(ctx context.Context, userID, wishlistID int, name string) (*models.Wishlist, error) {
+	res, err := database.DB.ExecContext(ctx, "UPDATE wishlists SET name=$1 WHERE id=$2 AND user_id=$3", name, wishlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrWishlistNotFound
+	}
+	return GetWishlist(ctx, userID, wishlistID)
+}
+
+func DeleteWishlist(ctx context.Context, userID, wishlistID int) error {
+	res, err := database.DB.ExecContext(ctx, "DELETE FROM wishlists WHERE id=$1 AND user_id=$2", wishlistID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+// addItem saves a product to a list at its current price, which later price
+// drops are measured against. Adding a product twice keeps the original row;
+// the no-op update only makes RETURNING see it, so no row means no product.
+func addItem(ctx context.Context, q database.Querier, wishlistID, productID int) error {
+	query := `INSERT INTO wishlist_items (wishlist_id, product_id, notified_price)
+		SELECT $1, p.id, ` + EffectivePrice + ` FROM products p ` + SaleJoin + ` WHERE p.id=$2 AND p.archived_at IS NULL
+		ON CONFLICT (wishlist_id, product_id) DO UPDATE SET wishlist_id = EXCLUDED.wishlist_id
+		RETURNING product_id`
+	err := q.QueryRowContext(ctx, query, wishlistID, productID).Scan(&productID)
+	if err == sql.ErrNoRows {
+		return ErrProductNotFound
+	}
+	return err
+}
+
+func AddWishlistItem(ctx context.Context, userID, wishlistID, productID int) (*models.Wishlist, error) {
+	if err := ownWishlist(ctx, database.DB, userID, wishlistID); err != nil {
+		return nil, err
+	}
+	if err := addItem(ctx, database.DB, wishlistID, productID); err != nil {
+		return nil, err
+	}
+	return GetWishlist(ctx, userID, wishlistID)
+}
+
+func RemoveWishlistItem(ctx context.Context, userID, wishlistID, productID int) error {
+	query := `DELETE FROM wishlist_items i USING wishlists w
+		WHERE w.id = i.wishlist_id AND w.id=$1 AND w.user_id=$2 AND i.product_id=$3`
+	res, err := database.DB.ExecContext(ctx, query, wishlistID, userID, productID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if err := ownWishlist(ctx, database.DB, userID, wishlistID); err != nil {
+			return err
+		}
+		return ErrWishlistItemNotFound
+	}
+	return nil
+}
+
+// MoveToCart takes a product off a wishlist and puts quantity of it in the cart
+func MoveToCart(ctx context.Context, userID, wishlistID, productID, quantity int) (*models.Cart, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM wishlist_items i USING wishlists w
+		WHERE w.id = i.wishlist_id AND w.id=$1 AND w.user_id=$2 AND i.product_id=$3`
+	res, err := tx.ExecContext(ctx, query, wishlistID, userID, productID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if err := ownWishlist(ctx, tx, userID, wishlistID); err != nil {
+			return nil, err
+		}
+		return nil, ErrWishlistItemNotFound
+	}
+
+	item := models.Cart{UserID: userID, ProductID: productID, Quantity: quantity}
+	query = `INSERT INTO cart (user_id, product_id, quantity)
+		SELECT $1, id, $3 FROM products WHERE id=$2 AND archived_at IS NULL RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, userID, productID, quantity).Scan(&item.ID, &item.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, tx.Commit()
+}
+
+// MoveToWishlist saves a cart product for later: it leaves the cart and joins
+// the given list
+func MoveToWishlist(ctx context.Context, userID, productID, wishlistID int) (*models.Wishlist, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := ownWishlist(ctx, tx, userID, wishlistID); err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM cart WHERE user_id=$1 AND product_id=$2", userID, productID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotInCart
+	}
+	if err := addItem(ctx, tx, wishlistID, productID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetWishlist(ctx, userID, wishlistID)
+}
+
+// ShareWishlist returns the list's share token, creating one if the list is
+// not shared yet
+func ShareWishlist(ctx context.Context, userID, wishlistID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var token string
+	query := "UPDATE wishlists SET share_token = COALESCE(share_token, $1) WHERE id=$2 AND user_id=$3 RETURNING share_token"
+	err := database.DB.QueryRowContext(ctx, query, hex.EncodeToString(b), wishlistID, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", ErrWishlistNotFound
+	}
+	return token, err
+}
+
+// UnshareWishlist revokes the share token; old links stop working
+func UnshareWishlist(ctx context.Context, userID, wishlistID int) error {
+	res, err := database.DB.ExecContext(ctx, "UPDATE wishlists SET share_token=NULL WHERE id=$1 AND user_id=$2", wishlistID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
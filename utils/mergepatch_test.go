@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"replaces a field", `{"name":"Lamp","price":20}`, `{"price":15}`, `{"name":"Lamp","price":15}`},
+		{"adds a field", `{"name":"Lamp"}`, `{"category":"home"}`, `{"name":"Lamp","category":"home"}`},
+		{"null removes a field", `{"name":"Lamp","sku":"L-1"}`, `{"sku":null}`, `{"name":"Lamp"}`},
+		{"null on a missing field", `{"name":"Lamp"}`, `{"sku":null}`, `{"name":"Lamp"}`},
+		{"merges nested objects", `{"a":{"b":1,"c":2}}`, `{"a":{"c":3,"d":4}}`, `{"a":{"b":1,"c":3,"d":4}}`},
+		{"null inside a nested object", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{"object replaces a scalar", `{"a":1}`, `{"a":{"b":null,"c":2}}`, `{"a":{"c":2}}`},
+		{"arrays are replaced whole", `{"tags":["a","b"]}`, `{"tags":["c"]}`, `{"tags":["c"]}`},
+		{"empty patch", `{"name":"Lamp"}`, `{}`, `{"name":"Lamp"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotV, wantV interface{}
+			json.Unmarshal(got, &gotV)
+			json.Unmarshal([]byte(tt.want), &wantV)
+			if !reflect.DeepEqual(gotV, wantV) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchRejectsNonObjectPatches(t *testing.T) {
+	for _, patch := range []string{`null`, `[]`, `"name"`, `3`} {
+		if _, err := MergePatch([]byte(`{"name":"Lamp"}`), []byte(patch)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("patch %s: err = %v, want ErrInvalidPatch", patch, err)
+		}
+	}
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); err == nil || errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("malformed patch: err = %v, want a JSON syntax error", err)
+	}
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"e-commerce/config"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 	"time"
 )
 
@@ -13,10 +13,22 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+var (
+	jwtSecret []byte
+	tokenTTL  = 24 * time.Hour
+)
+
+// ConfigureTokens sets the signing secret and lifetime; it must run before tokens are issued
+func ConfigureTokens(cfg config.AuthConfig) {
+	jwtSecret = []byte(cfg.JWTSecret)
+	tokenTTL = cfg.TokenTTL
+}
 
 func GenerateToken(id int, isAdmin bool) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	if len(jwtSecret) == 0 {
+		return "", fmt.Errorf("jwt secret not configured")
+	}
+	expirationTime := time.Now().Add(tokenTTL)
 	// make a claims struct with given id, use the expiration time in ur registeredclaims object
 	claims := &Claims{
 		UserID:  id,
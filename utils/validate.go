@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ValidationErrors maps a JSON field name to the reasons it failed validation
+type ValidationErrors map[string][]string
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for field, msgs := range v {
+		parts = append(parts, fmt.Sprintf("%s: %s", field, strings.Join(msgs, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validate checks every field of a struct against its `validate` tag and returns
+// all failures at once. Supported rules: required, email, password, min=N, max=N, gt=N,
+// oneof=a|b. min/max compare length for strings and slices and value for numbers.
+// Nested structs and slices of structs are validated too, with their errors keyed
+// as "parent.field" and "parent[i].field". A rule the validator does not know
+// fails the field, so a typo in a tag cannot silently disable a check.
+func Validate(s interface{}) ValidationErrors {
+	errs := ValidationErrors{}
+	validateStruct(reflect.Indirect(reflect.ValueOf(s)), "", errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateStruct(val reflect.Value, prefix string, errs ValidationErrors) {
+	if val.Kind() != reflect.Struct {
+		return
+	}
+	typ := val.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("validate")
+		name := prefix + jsonName(field)
+		value := val.Field(i)
+
+		// optional pointers are only validated when present
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				if strings.Contains(tag, "required") {
+					errs[name] = append(errs[name], "is required")
+				}
+				continue
+			}
+			value = value.Elem()
+		}
+
+		if value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{}) {
+			validateStruct(value, name+".", errs)
+			continue
+		}
+		if value.Kind() == reflect.Slice {
+			for j := 0; j < value.Len(); j++ {
+				validateStruct(reflect.Indirect(value.Index(j)), fmt.Sprintf("%s[%d].", name, j), errs)
+			}
+		}
+
+		if tag == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if msg := checkRule(rule, value); msg != "" {
+				errs[name] = append(errs[name], msg)
+			}
+		}
+	}
+}
+
+func checkRule(rule string, value reflect.Value) string {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "email":
+		if value.Kind() == reflect.String && value.String() != "" {
+			if _, err := mail.ParseAddress(value.String()); err != nil {
+				return "must be a valid email address"
+			}
+		}
+	case "password":
+		if value.Kind() == reflect.String && !isStrongPassword(value.String()) {
+			return "must contain at least one letter and one digit"
+		}
+	case "min", "max", "gt":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("has an invalid %s rule", name)
+		}
+		n, unit := numericValue(value)
+		if failsBound(name, n, limit) {
+			return boundMessage(name, arg, limit, unit)
+		}
+	case "oneof":
+		options := strings.Split(arg, "|")
+		for _, option := range options {
+			if fmt.Sprint(value.Interface()) == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of: %s", strings.Join(options, ", "))
+	default:
+		return fmt.Sprintf("has an unknown rule %q", rule)
+	}
+	return ""
+}
+
+// numericValue returns the number a bound is compared against and, for lengths, the unit
+// being counted ("character" or "item"); the unit is empty for plain numbers
+func numericValue(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), "character"
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), "item"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	return 0, ""
+}
+
+func failsBound(rule string, n, limit float64) bool {
+	switch rule {
+	case "min":
+		return n < limit
+	case "max":
+		return n > limit
+	case "gt":
+		return n <= limit
+	}
+	return false
+}
+
+func boundMessage(rule, arg string, limit float64, unit string) string {
+	if unit != "" {
+		if limit != 1 {
+			unit += "s"
+		}
+		switch rule {
+		case "min":
+			return fmt.Sprintf("must be at least %s %s", arg, unit)
+		case "max":
+			return fmt.Sprintf("must be at most %s %s", arg, unit)
+		}
+	}
+	switch rule {
+	case "min":
+		return fmt.Sprintf("must be at least %s", arg)
+	case "max":
+		return fmt.Sprintf("must be at most %s", arg)
+	default:
+		return fmt.Sprintf("must be greater than %s", arg)
+	}
+}
+
+func isStrongPassword(password string) bool {
+	var hasLetter, hasDigit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
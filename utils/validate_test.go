@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	type item struct {
+		Qty int `json:"qty" validate:"min=1"`
+	}
+	type request struct {
+		Name     string            `json:"name" validate:"required,max=5"`
+		Email    string            `json:"email" validate:"email"`
+		Password string            `json:"password" validate:"password"`
+		Tags     []string          `json:"tags" validate:"min=1,max=2"`
+		Count    int               `json:"count" validate:"min=2,max=4"`
+		Price    float64           `json:"price" validate:"gt=0"`
+		Kind     string            `json:"kind" validate:"oneof=a|b c"`
+		Note     *string           `json:"note" validate:"min=2"`
+		Ref      *int              `json:"ref" validate:"required"`
+		Items    []item            `json:"items"`
+		Attrs    map[string]string `json:"attrs" validate:"max=1"`
+		Code     string            `json:"code" validate:"min=1"`
+	}
+	valid := func() request {
+		ref := 1
+		return request{Name: "abc", Email: "a@example.com", Password: "abc123", Tags: []string{"x"},
+			Count: 3, Price: 0.5, Kind: "b c", Code: "c", Ref: &ref, Items: []item{{Qty: 1}}}
+	}
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		modify func(*request)
+		field  string
+		want   string
+	}{
+		{"valid", func(*request) {}, "", ""},
+		{"required", func(r *request) { r.Name = "" }, "name", "is required"},
+		{"max length", func(r *request) { r.Name = "abcdef" }, "name", "must be at most 5 characters"},
+		{"max counts runes", func(r *request) { r.Name = "ééééé" }, "", ""},
+		{"email", func(r *request) { r.Email = "nope" }, "email", "must be a valid email address"},
+		{"empty email", func(r *request) { r.Email = "" }, "", ""},
+		{"password", func(r *request) { r.Password = "abcdefgh" }, "password", "must contain at least one letter and one digit"},
+		{"min slice", func(r *request) { r.Tags = nil }, "tags", "must be at least 1 item"},
+		{"max slice", func(r *request) { r.Tags = []string{"x", "y", "z"} }, "tags", "must be at most 2 items"},
+		{"max map", func(r *request) { r.Attrs = map[string]string{"a": "1", "b": "2"} }, "attrs", "must be at most 1 item"},
+		{"min one character", func(r *request) { r.Code = "" }, "code", "must be at least 1 character"},
+		{"min number", func(r *request) { r.Count = 1 }, "count", "must be at least 2"},
+		{"max number", func(r *request) { r.Count = 5 }, "count", "must be at most 4"},
+		{"gt", func(r *request) { r.Price = 0 }, "price", "must be greater than 0"},
+		{"oneof", func(r *request) { r.Kind = "c" }, "kind", "must be one of: a, b c"},
+		{"oneof first", func(r *request) { r.Kind = "a" }, "", ""},
+		{"nil pointer skipped", func(r *request) { r.Note = nil }, "", ""},
+		{"pointer checked", func(r *request) { r.Note = str("x") }, "note", "must be at least 2 characters"},
+		{"nil required pointer", func(r *request) { r.Ref = nil }, "ref", "is required"},
+		{"nested slice", func(r *request) { r.Items = []item{{Qty: 1}, {Qty: 0}} }, "items[1].qty", "must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			errs := Validate(&r)
+			if tt.field == "" {
+				if errs != nil {
+					t.Fatalf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !reflect.DeepEqual(errs[tt.field], []string{tt.want}) {
+				t.Fatalf("errors = %v, want %s: %s", errs, tt.field, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsUnknownRules(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"unknown rule", &struct {
+			Tags []string `json:"tags" validate:"dive"`
+		}{}, `has an unknown rule "dive"`},
+		{"omitempty", &struct {
+			Qty int `json:"qty" validate:"omitempty,min=1"`
+		}{Qty: 2}, `has an unknown rule "omitempty"`},
+		{"bad bound", &struct {
+			Qty int `json:"qty" validate:"min=one"`
+		}{}, "has an invalid min rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(tt.v)
+			var msgs []string
+			for _, m := range errs {
+				msgs = append(msgs, m...)
+			}
+			if len(msgs) != 1 || !strings.Contains(msgs[0], tt.want) {
+				t.Fatalf("errors = %v, want %s", errs, tt.want)
+			}
+		})
+	}
+}
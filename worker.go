@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"e-commerce/config"
+	"e-commerce/events"
+	"e-commerce/jobs"
+	"e-commerce/logging"
+	"e-commerce/metrics"
+	"e-commerce/services"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// registerJobs installs every job handler and cron schedule. It runs in both the
+// server and the worker process so either can pick up any job.
+func registerJobs(cfg *config.Config) error {
+	jobs.Register("orders.expire", func(ctx context.Context, _ json.RawMessage) error {
+		n, err := services.ExpireUnpaidOrders(ctx, cfg.Inventory.ReservationTTL)
+		if n > 0 {
+			metrics.OrdersExpired.Add(float64(n))
+			logging.FromContext(ctx).Info("Expired unpaid orders", "count", n, "ttl", cfg.Inventory.ReservationTTL)
+		}
+		return err
+	})
+	jobs.Register(services.DeliverWebhookJob, services.DeliverWebhook)
+	jobs.Register(services.SendNotificationJob, services.SendNotification)
+	jobs.Register(services.ImportProductsJob, services.RunProductImport)
+	jobs.Register(services.ApplyPriceJob, services.ApplyPriceChange)
+	jobs.Register("jobs.prune", func(ctx context.Context, _ json.RawMessage) error {
+		_, err := jobs.Prune(ctx, cfg.Jobs.Retention)
+		return err
+	})
+	jobs.Register("idempotency.prune", func(ctx context.Context, _ json.RawMessage) error {
+		_, err := services.PruneIdempotencyKeys(ctx)
+		return err
+	})
+
+	if err := jobs.Schedule(fmt.Sprintf("@every %s", cfg.Inventory.ExpiryInterval), "orders.expire", nil); err != nil {
+		return fmt.Errorf("orders.expire schedule: %w", err)
+	}
+	if err := jobs.Schedule("@hourly", "idempotency.prune", nil); err != nil {
+		return fmt.Errorf("idempotency.prune schedule: %w", err)
+	}
+	return jobs.Schedule("@hourly", "jobs.prune", nil)
+}
+
+// startBackground starts the job workers and the outbox relay. Merchant webhooks
+// and email notifications are always fed from the relay; EVENT_SINKS adds the others. The returned
+// function stops both and waits for work in progress.
+func startBackground(cfg *config.Config) (stop func(), err error) {
+	sinks, closeSinks, err := eventSinks(cfg.Events)
+	if err != nil {
+		return nil, err
+	}
+	relay := &events.Relay{
+		Sinks:       append(sinks, services.WebhookSink{}, services.NotificationSink{}),
+		Interval:    cfg.Events.RelayInterval,
+		BatchSize:   cfg.Events.BatchSize,
+		Timeout:     cfg.Events.PublishTimeout,
+		MaxAttempts: cfg.Events.RelayMaxAttempts,
+		Backoff:     cfg.Events.RelayBackoff,
+		MaxBackoff:  cfg.Events.RelayMaxBackoff,
+	}
+	stopRelay := relay.Start()
+	stopJobs := jobs.Start(cfg.Jobs)
+
+	return func() {
+		stopJobs()
+		stopRelay()
+		closeSinks()
+	}, nil
+}
+
+// eventSinks builds the sinks named in EVENT_SINKS
+func eventSinks(cfg config.EventsConfig) ([]events.Sink, func(), error) {
+	var sinks []events.Sink
+	closeSinks := func() {}
+	for _, name := range cfg.Sinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, events.LogSink{})
+		case "http":
+			sinks = append(sinks, events.HTTPSink{URL: cfg.HTTPURL, Client: &http.Client{Timeout: cfg.PublishTimeout}})
+		case "nats":
+			broker, err := events.NewNATSBroker(cfg.NATSURL)
+			if err != nil {
+				return nil, nil, fmt.Errorf("connecting to NATS: %w", err)
+			}
+			sinks = append(sinks, events.BrokerSink{Broker: broker, Prefix: cfg.SubjectPrefix})
+			closeSinks = broker.Close
+		}
+	}
+	return sinks, closeSinks, nil
+}
+
+// runWorker processes jobs and relays events without serving HTTP until ctx is cancelled
+func runWorker(ctx context.Context, cfg *config.Config) {
+	if cfg.Jobs.Workers <= 0 {
+		slog.Error("The worker command needs JOBS_WORKERS of at least 1")
+		return
+	}
+	stopBackground, err := startBackground(cfg)
+	if err != nil {
+		slog.Error("Error starting worker", "error", err)
+		return
+	}
+	<-ctx.Done()
+	slog.Info("Shutdown signal received, waiting for running jobs")
+	stopBackground()
+	slog.Info("Worker stopped")
+}